@@ -1,27 +1,141 @@
 package main
 
 import (
+	"context"
 	"log"
+	"log/slog"
 	"os"
 	"runtime"
+	"strconv"
+	"time"
 
 	"github.com/cert-manager/cert-manager/pkg/acme/webhook/cmd"
 
 	"github.com/krancovia/cert-manager-webhook-gandi/internal/gandi"
+	"github.com/krancovia/cert-manager-webhook-gandi/internal/logging"
+	"github.com/krancovia/cert-manager-webhook-gandi/internal/metrics"
+	"github.com/krancovia/cert-manager-webhook-gandi/internal/tracing"
 	"github.com/krancovia/cert-manager-webhook-gandi/internal/version"
 )
 
 func main() {
+	logger, err := logging.NewLogger(
+		os.Stderr,
+		os.Getenv("LOG_FORMAT"),
+		os.Getenv("LOG_LEVEL"),
+	)
+	if err != nil {
+		panic(err)
+	}
+	// Anything logged using the standard log package, or slog's default
+	// logger, is written by the same logger.
+	slog.SetDefault(logger)
+
 	ver := version.GetVersion()
-	log.Printf(
-		"Starting cert-manager-webhook-gandi version=%s commit=%s GOMAXPROCS=%d GOMEMLIMIT=%s \n",
-		ver.Version, ver.GitCommit, runtime.GOMAXPROCS(0), os.Getenv("GOMEMLIMIT"),
+	logger.Info(
+		"Starting cert-manager-webhook-gandi",
+		"version", ver.Version,
+		"commit", ver.GitCommit,
+		"GOMAXPROCS", runtime.GOMAXPROCS(0),
+		"GOMEMLIMIT", os.Getenv("GOMEMLIMIT"),
 	)
 
+	shutdownTracing, err := tracing.Setup(context.Background(), ver)
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Error("error shutting down tracing", "error", err)
+		}
+	}()
+	if tracing.Enabled() {
+		logger.Info("Exporting traces over OTLP")
+	}
+
 	groupName := os.Getenv("GROUP_NAME")
 	if groupName == "" {
 		panic("GROUP_NAME must be specified")
 	}
 
-	cmd.RunWebhookServer(groupName, gandi.NewSolver())
+	solverOpts := []gandi.SolverOption{
+		gandi.WithGroupName(groupName),
+		gandi.WithLogger(logger),
+	}
+
+	if ns := os.Getenv("CLUSTER_RESOURCE_NAMESPACE"); ns != "" {
+		solverOpts = append(solverOpts, gandi.WithClusterResourceNamespace(ns))
+	}
+
+	if mustParseBool("LEASE_LOCKING_ENABLED") {
+		identity := os.Getenv("POD_NAME")
+		if identity == "" {
+			var err error
+			if identity, err = os.Hostname(); err != nil {
+				panic(err)
+			}
+		}
+		solverOpts = append(
+			solverOpts,
+			gandi.WithLeaseLocking(gandi.LeaseLockingOptions{
+				Namespace:     os.Getenv("POD_NAMESPACE"),
+				Identity:      identity,
+				LeaseDuration: mustParseDuration("LEASE_DURATION"),
+			}),
+		)
+	}
+
+	if mustParseBool("GC_ENABLED") {
+		solverOpts = append(
+			solverOpts,
+			gandi.WithGarbageCollection(gandi.GarbageCollectionOptions{
+				Interval:    mustParseDuration("GC_INTERVAL"),
+				GracePeriod: mustParseDuration("GC_GRACE_PERIOD"),
+				DryRun:      mustParseBool("GC_DRY_RUN"),
+			}),
+		)
+	}
+
+	if addr := os.Getenv("METRICS_BIND_ADDRESS"); addr != "" {
+		reg := metrics.NewRegistry(ver)
+		solverOpts = append(solverOpts, gandi.WithMetrics(reg))
+		go func() {
+			if err := metrics.Serve(context.Background(), addr, reg); err != nil {
+				logger.Error("error serving metrics", "address", addr, "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	cmd.RunWebhookServer(groupName, gandi.NewSolver(solverOpts...))
+}
+
+// mustParseBool returns the boolean value of the named environment variable,
+// or false if it is unset. It panics if the variable is set to anything that
+// isn't a boolean.
+func mustParseBool(name string) bool {
+	val := os.Getenv(name)
+	if val == "" {
+		return false
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		log.Panicf("%s must be a boolean: %v", name, err)
+	}
+	return b
+}
+
+// mustParseDuration returns the value of the named environment variable as a
+// duration, or zero if it is unset. It panics if the variable is set to
+// anything that isn't a duration.
+func mustParseDuration(name string) time.Duration {
+	val := os.Getenv(name)
+	if val == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		log.Panicf("%s must be a duration: %v", name, err)
+	}
+	return d
 }
@@ -0,0 +1,144 @@
+package gandi
+
+import (
+	"context"
+	"fmt"
+
+	cmacme "github.com/cert-manager/cert-manager/pkg/apis/acme/v1"
+	cmclient "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned"
+	cminformers "github.com/cert-manager/cert-manager/pkg/client/informers/externalversions"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// challengeUIDIndex indexes Challenges by UID.
+	challengeUIDIndex = "uid"
+	// challengeDNS01Index indexes DNS-01 Challenges by DNS name and key, which
+	// together are unique to a Challenge.
+	challengeDNS01Index = "dns01"
+)
+
+// challengeCache serves cert-manager Challenges from a single cluster-wide
+// informer, so that finding the Challenge a ChallengeRequest corresponds to
+// costs the API server nothing, however many Challenges the cluster holds.
+type challengeCache struct {
+	informer cache.SharedIndexInformer
+}
+
+// newChallengeCache returns a challengeCache whose informer watches Challenges
+// through the given client until the given stop channel is closed.
+func newChallengeCache(
+	client cmclient.Interface,
+	stopCh <-chan struct{},
+) *challengeCache {
+	factory := cminformers.NewSharedInformerFactoryWithOptions(
+		client,
+		0, // Never resync; watching is enough to keep the cache current
+		cminformers.WithTransform(stripManagedFields),
+	)
+	informer := factory.Acme().V1().Challenges().Informer()
+	// Adding indexers only fails once the informer has been started
+	_ = informer.AddIndexers(cache.Indexers{
+		challengeUIDIndex: func(obj any) ([]string, error) {
+			ch, ok := obj.(*cmacme.Challenge)
+			if !ok {
+				return nil, nil
+			}
+			return []string{string(ch.UID)}, nil
+		},
+		challengeDNS01Index: func(obj any) ([]string, error) {
+			ch, ok := obj.(*cmacme.Challenge)
+			if !ok || ch.Spec.Type != cmacme.ACMEChallengeTypeDNS01 {
+				return nil, nil
+			}
+			return []string{dns01IndexKey(ch.Spec.DNSName, ch.Spec.Key)}, nil
+		},
+	})
+	factory.Start(stopCh)
+	return &challengeCache{informer: informer}
+}
+
+// byUID returns the Challenge with the given UID, if any.
+func (c *challengeCache) byUID(
+	ctx context.Context,
+	uid types.UID,
+) ([]*cmacme.Challenge, error) {
+	return c.byIndex(ctx, challengeUIDIndex, string(uid))
+}
+
+// byDNS01 returns the DNS-01 Challenges with the given DNS name and key.
+func (c *challengeCache) byDNS01(
+	ctx context.Context,
+	dnsName string,
+	key string,
+) ([]*cmacme.Challenge, error) {
+	return c.byIndex(ctx, challengeDNS01Index, dns01IndexKey(dnsName, key))
+}
+
+// list returns all Challenges in the cluster.
+func (c *challengeCache) list(ctx context.Context) ([]*cmacme.Challenge, error) {
+	if err := c.waitForSync(ctx); err != nil {
+		return nil, err
+	}
+	return challengesOf(c.informer.GetStore().List()), nil
+}
+
+func (c *challengeCache) byIndex(
+	ctx context.Context,
+	index string,
+	value string,
+) ([]*cmacme.Challenge, error) {
+	if err := c.waitForSync(ctx); err != nil {
+		return nil, err
+	}
+	objs, err := c.informer.GetIndexer().ByIndex(index, value)
+	if err != nil {
+		return nil, err
+	}
+	return challengesOf(objs), nil
+}
+
+// hasSynced returns true if the informer has synced, after which lookups never
+// block.
+func (c *challengeCache) hasSynced() bool {
+	return c.informer.HasSynced()
+}
+
+// waitForSync blocks until the informer has synced or the given context is
+// done. Once the informer has synced, it returns immediately.
+func (c *challengeCache) waitForSync(ctx context.Context) error {
+	if !cache.WaitForCacheSync(ctx.Done(), c.informer.HasSynced) {
+		return fmt.Errorf(
+			"timed out waiting for Challenges to be cached: %w",
+			ctx.Err(),
+		)
+	}
+	return nil
+}
+
+// challengesOf returns the Challenges among the given cached objects. The
+// returned Challenges are shared with the cache and must not be modified.
+func challengesOf(objs []any) []*cmacme.Challenge {
+	challenges := make([]*cmacme.Challenge, 0, len(objs))
+	for _, obj := range objs {
+		if ch, ok := obj.(*cmacme.Challenge); ok {
+			challenges = append(challenges, ch)
+		}
+	}
+	return challenges
+}
+
+func dns01IndexKey(dnsName string, key string) string {
+	return dnsName + "\x00" + key
+}
+
+// stripManagedFields drops the managed fields from cached objects, which are
+// never used and can account for a sizable portion of each object.
+func stripManagedFields(obj any) (any, error) {
+	if accessor, err := meta.Accessor(obj); err == nil {
+		accessor.SetManagedFields(nil)
+	}
+	return obj, nil
+}
@@ -0,0 +1,73 @@
+package gandi
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cmfake "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestChallengeCache(t *testing.T) {
+	client := cmfake.NewSimpleClientset(
+		newTestChallenge("team-a", "challenge-a", "key-a"),
+		newTestChallenge("team-b", "challenge-b", "key-b"),
+	)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	c := newChallengeCache(client, stopCh)
+	ctx := context.Background()
+
+	challenges, err := c.byUID(ctx, "team-a/challenge-a")
+	require.NoError(t, err)
+	require.Len(t, challenges, 1)
+	require.Equal(t, "challenge-a", challenges[0].Name)
+
+	challenges, err = c.byDNS01(ctx, testZone, "key-b")
+	require.NoError(t, err)
+	require.Len(t, challenges, 1)
+	require.Equal(t, "challenge-b", challenges[0].Name)
+
+	challenges, err = c.byDNS01(ctx, testZone, "key-c")
+	require.NoError(t, err)
+	require.Empty(t, challenges)
+
+	// New Challenges should be found without any further action
+	_, err = client.AcmeV1().Challenges("team-c").Create(
+		ctx,
+		newTestChallenge("team-c", "challenge-c", "key-c"),
+		metav1.CreateOptions{},
+	)
+	require.NoError(t, err)
+	require.Eventually(
+		t,
+		func() bool {
+			challenges, err = c.byDNS01(ctx, testZone, "key-c")
+			return err == nil && len(challenges) == 1
+		},
+		5*time.Second,
+		10*time.Millisecond,
+	)
+
+	challenges, err = c.list(ctx)
+	require.NoError(t, err)
+	require.Len(t, challenges, 3)
+
+	// Challenges should only ever have been listed and watched
+	for _, action := range client.Actions() {
+		require.Contains(t, []string{"list", "watch", "create"}, action.GetVerb())
+	}
+}
+
+func TestChallengeCacheNotSynced(t *testing.T) {
+	// An informer that is never started never syncs
+	stopCh := make(chan struct{})
+	close(stopCh)
+	c := newChallengeCache(cmfake.NewSimpleClientset(), stopCh)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := c.byUID(ctx, "team-a/challenge-a")
+	require.ErrorContains(t, err, "timed out waiting for Challenges")
+}
@@ -1,181 +1,313 @@
 package gandi
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
-	"strings"
 	"time"
-)
 
-const ttl = 300 // The minimum TTL allowed by Gandi
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	"github.com/krancovia/cert-manager-webhook-gandi/pkg/livedns"
+)
 
-type resourceRecordSet struct {
-	Type   string   `json:"rrset_type"`
-	TTL    int      `json:"rrset_ttl"`
-	Name   string   `json:"rrset_name"`
-	Values []string `json:"rrset_values"`
+// liveDNS is the subset of the LiveDNS API on which the solver relies. It is
+// implemented by *livedns.Client.
+type liveDNS interface {
+	GetDomain(ctx context.Context, fqdn string) (*livedns.Domain, error)
+	ListRecords(ctx context.Context, fqdn string, opts ...livedns.ListOption) ([]livedns.RRSet, error)
+	GetRecord(ctx context.Context, fqdn string, name string, rrsetType string) (*livedns.RRSet, error)
+	CreateRecord(ctx context.Context, fqdn string, rrs livedns.RRSet) error
+	UpdateRecord(ctx context.Context, fqdn string, rrs livedns.RRSet) error
+	DeleteRecord(ctx context.Context, fqdn string, name string, rrsetType string) error
 }
 
+// client adapts the LiveDNS API to the needs of the solver. It deals in TXT
+// record values without the quotes Gandi places around them, and traces and
+// measures every call to the API.
 type client struct {
-	baseURL     string // Overridable for testing purposes
-	accessToken string
-	client      *http.Client
+	api liveDNS
+	// transport executes the requests made by api. It is shared by all clients
+	// for the same credential.
+	transport *transport
+	retry     retryPolicy
+	metrics   *metrics
 }
 
-func newClient(accessToken string) *client {
+// newClient returns a client for the LiveDNS API described by the given
+// configuration, which is expected to have been defaulted, authenticated by
+// the given access token, that executes requests using the given HTTP client.
+// The solver obtains clients from a clientPool instead, which shares one HTTP
+// client among them.
+func newClient(cfg Config, accessToken string, httpClient *http.Client) *client {
+	t := &transport{client: httpClient}
+	opts := []livedns.Option{
+		livedns.WithEndpoint(cfg.APIEndpoint),
+		livedns.WithHTTPClient(t),
+	}
+	if cfg.CredentialType == CredentialTypeAPIKey {
+		opts = append(opts, livedns.WithAPIKey())
+	}
 	return &client{
-		baseURL:     "https://dns.api.gandi.net/api/v5",
-		accessToken: accessToken,
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		api:       livedns.NewClient(accessToken, opts...),
+		transport: t,
+		retry:     cfg.retryPolicy(),
 	}
 }
 
-func (c *client) getTxtRecordValues(domain string, name string) ([]string, error) {
-	// GET <API BASE URL>/domains/<DOMAIN>/records/<NAME>/TXT
-	req, err := http.NewRequest(http.MethodGet, c.txtRecordURL(domain, name), nil)
-	if err != nil {
-		return nil, fmt.Errorf("error building LiveDNS API request: %w", err)
-	}
-	status, body, err := c.doRequest(req)
-	if err != nil {
-		return nil, fmt.Errorf("error executing Live DNS API request: %w", err)
-	}
-	if status == http.StatusNotFound {
-		return nil, nil
+// getTxtRecord returns the TXT resource record set with the given name in the
+// given domain, or nil if no such record set exists. Values are returned with
+// any surrounding quotes removed.
+func (c *client) getTxtRecord(
+	ctx context.Context,
+	domain string,
+	name string,
+) (*livedns.RRSet, error) {
+	rrs, err := c.getRecord(ctx, domain, name, livedns.TypeTXT)
+	if rrs != nil {
+		for i := range rrs.Values {
+			rrs.Values[i] = livedns.UnquoteTXT(rrs.Values[i])
+		}
 	}
-	if status == http.StatusOK {
-		rrs := &resourceRecordSet{}
-		if err := json.Unmarshal(body, rrs); err != nil {
-			return nil, fmt.Errorf("error unmarshaling resource record set from JSON: %w", err)
+	return rrs, err
+}
+
+// getRecord returns the resource record set with the given name and type in
+// the given domain, or nil if no such record set exists.
+func (c *client) getRecord(
+	ctx context.Context,
+	domain string,
+	name string,
+	rrsetType string,
+) (rrs *livedns.RRSet, err error) {
+	err = c.call(ctx, "getRecord", http.MethodGet, domain, name, func(ctx context.Context) error {
+		rrs, err = c.api.GetRecord(ctx, domain, name, rrsetType)
+		if livedns.IsNotFound(err) {
+			return nil
 		}
-		for i := range rrs.Values {
-			rrs.Values[i] = strings.Trim(rrs.Values[i], `"`)
+		return err
+	})
+	return rrs, err
+}
+
+// listTxtRecords returns all TXT resource record sets in the given domain.
+// Values are returned with any surrounding quotes removed.
+func (c *client) listTxtRecords(
+	ctx context.Context,
+	domain string,
+) (rrsets []livedns.RRSet, err error) {
+	err = c.call(ctx, "listTxtRecords", http.MethodGet, domain, "", func(ctx context.Context) error {
+		rrsets, err = c.api.ListRecords(ctx, domain, livedns.WithType(livedns.TypeTXT))
+		return err
+	})
+	for i := range rrsets {
+		for j := range rrsets[i].Values {
+			rrsets[i].Values[j] = livedns.UnquoteTXT(rrsets[i].Values[j])
 		}
-		return rrs.Values, nil
 	}
-	return nil, fmt.Errorf(
-		"unexpected HTTP status in response to Live DNS API request: %d",
-		status,
-	)
+	return rrsets, err
+}
+
+// domainExists returns true if the given domain is managed by Gandi LiveDNS
+// and is visible to the client's credential.
+func (c *client) domainExists(ctx context.Context, domain string) (exists bool, err error) {
+	err = c.call(ctx, "domainExists", http.MethodGet, domain, "", func(ctx context.Context) error {
+		_, err = c.api.GetDomain(ctx, domain)
+		switch {
+		case err == nil:
+			exists = true
+		case livedns.IsNotFound(err), livedns.IsForbidden(err):
+			// Gandi refuses requests for domains that belong to someone else
+			return nil
+		}
+		return err
+	})
+	return exists, err
 }
 
-func (c *client) createTxtRecord(domain, name string, values []string) error {
-	// POST <API BASE URL>/domains/<DOMAIN>/records
-	body, err := json.Marshal(
-		resourceRecordSet{
-			Type:   "TXT",
+func (c *client) createTxtRecord(
+	ctx context.Context,
+	domain string,
+	name string,
+	ttl int,
+	values []string,
+) error {
+	return c.call(ctx, "createTxtRecord", http.MethodPost, domain, name, func(ctx context.Context) error {
+		return c.api.CreateRecord(ctx, domain, livedns.RRSet{
+			Type:   livedns.TypeTXT,
 			TTL:    ttl,
 			Name:   name,
-			Values: values,
-		},
-	)
-	if err != nil {
-		return fmt.Errorf("error marshaling resource record set to JSON: %w", err)
-	}
-	req, err := http.NewRequest(
-		http.MethodPost,
-		c.recordsURL(domain),
-		bytes.NewReader(body),
-	)
-	if err != nil {
-		return fmt.Errorf("error building LiveDNS API request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-	status, _, err := c.doRequest(req)
-	if err != nil {
-		return fmt.Errorf("error executing LiveDNS API request: %w", err)
-	}
-	if status != http.StatusCreated && status != http.StatusOK {
-		return fmt.Errorf(
-			"unexpected HTTP status in response to Live DNS API request: %d",
-			status,
-		)
-	}
-	return nil
+			Values: quoteTxtValues(values),
+		})
+	})
 }
 
-func (c *client) updateTxtRecord(domain, name string, values []string) error {
-	// PUT <API BASE URL>/domains/<DOMAIN>/records/<NAME>/TXT
-	body, err := json.Marshal(
-		struct {
-			TTL    int      `json:"rrset_ttl"`
-			Values []string `json:"rrset_values"`
-		}{
+func (c *client) updateTxtRecord(
+	ctx context.Context,
+	domain string,
+	name string,
+	ttl int,
+	values []string,
+) error {
+	return c.call(ctx, "updateTxtRecord", http.MethodPut, domain, name, func(ctx context.Context) error {
+		return c.api.UpdateRecord(ctx, domain, livedns.RRSet{
+			Type:   livedns.TypeTXT,
 			TTL:    ttl,
-			Values: values,
-		},
-	)
-	if err != nil {
-		return fmt.Errorf("error marshaling resource record set to JSON: %w", err)
-	}
-	req, err := http.NewRequest(
-		http.MethodPut,
-		c.txtRecordURL(domain, name),
-		bytes.NewReader(body),
-	)
-	if err != nil {
-		return fmt.Errorf("error building LiveDNS API request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-	status, _, err := c.doRequest(req)
-	if err != nil {
-		return fmt.Errorf("error executing LiveDNS API request: %w", err)
-	}
-	if status != http.StatusCreated && status != http.StatusOK {
-		return fmt.Errorf(
-			"unexpected HTTP status in response to Live DNS API request: %d",
-			status,
-		)
+			Name:   name,
+			Values: quoteTxtValues(values),
+		})
+	})
+}
+
+func (c *client) deleteTxtRecord(
+	ctx context.Context,
+	domain string,
+	name string,
+) error {
+	return c.call(ctx, "deleteTxtRecord", http.MethodDelete, domain, name, func(ctx context.Context) error {
+		return c.api.DeleteRecord(ctx, domain, name, livedns.TypeTXT)
+	})
+}
+
+// quoteTxtValues returns a copy of the given TXT record values with each one
+// surrounded by quotes, which is the form in which Gandi itself returns them.
+// Values that are already quoted are left as they are.
+func quoteTxtValues(values []string) []string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = livedns.QuoteTXT(value)
 	}
-	return nil
-}
-
-func (c *client) deleteTxtRecord(domain, name string) error {
-	// DELETE <API BASE URL>/domains/<DOMAIN>/records/<NAME>/TXT
-	req, err := http.NewRequest(
-		http.MethodDelete,
-		c.txtRecordURL(domain, name),
-		nil,
-	)
-	if err != nil {
-		return fmt.Errorf("error building LiveDNS API request: %w", err)
+	return quoted
+}
+
+// call makes a single call to the LiveDNS API, as performed by the given
+// function, which issues a request with the given HTTP method that is
+// retried in accordance with the client's retry policy. The call, including
+// any retries, is traced and measured under the given operation name. The
+// given domain and name, which may be empty, identify the record set the call
+// pertains to.
+func (c *client) call(
+	ctx context.Context,
+	operation string,
+	method string,
+	domain string,
+	name string,
+	fn func(context.Context) error,
+) error {
+	attrs := []attribute.KeyValue{zoneAttribute.String(domain)}
+	if name != "" {
+		attrs = append(attrs, entryAttribute.String(name))
 	}
-	status, _, err := c.doRequest(req)
-	if err != nil {
-		return fmt.Errorf("error executing LiveDNS API request: %w", err)
+	ctx, span := startSpan(ctx, "LiveDNS "+operation, attrs...)
+	scope := &requestScope{
+		operation: operation,
+		retry:     c.retry,
+		metrics:   c.metrics,
 	}
-	if status != http.StatusOK && status != http.StatusNoContent {
-		return fmt.Errorf(
-			"unexpected HTTP status in response to Live DNS API request: %d",
-			status,
-		)
+	start := time.Now()
+	err := fn(withRequestScope(ctx, scope))
+	c.metrics.observeRequest(method, operation, scope.status, time.Since(start))
+	if scope.status != 0 {
+		span.SetAttributes(semconv.HTTPResponseStatusCode(scope.status))
 	}
-	return nil
+	endSpan(span, err)
+	return err
 }
 
-func (c *client) txtRecordURL(domain, name string) string {
-	return fmt.Sprintf("%s/%s/TXT", c.recordsURL(domain), name)
+// requestScope carries what the transport needs to know about the LiveDNS API
+// call on whose behalf it executes requests, and what the call needs to know
+// about how they went.
+type requestScope struct {
+	operation string
+	retry     retryPolicy
+	metrics   *metrics
+	// status is the HTTP status of the last response received, or zero if
+	// none was.
+	status int
 }
 
-func (c *client) recordsURL(domain string) string {
-	return fmt.Sprintf("%s/domains/%s/records", c.baseURL, domain)
+type requestScopeKey struct{}
+
+// withRequestScope returns a copy of the given context carrying the given
+// requestScope.
+func withRequestScope(ctx context.Context, scope *requestScope) context.Context {
+	return context.WithValue(ctx, requestScopeKey{}, scope)
 }
 
-func (c *client) doRequest(req *http.Request) (int, []byte, error) {
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.accessToken))
-	res, err := c.client.Do(req)
-	if err != nil {
-		return 0, nil, err
+// requestScopeFrom returns the requestScope carried by the given context or,
+// if there is none, one with the default retry policy.
+func requestScopeFrom(ctx context.Context) *requestScope {
+	if scope, ok := ctx.Value(requestScopeKey{}).(*requestScope); ok {
+		return scope
 	}
-	defer res.Body.Close()
-	bodyBytes, err := io.ReadAll(res.Body)
-	if err != nil {
-		return res.StatusCode, nil, fmt.Errorf("error reading response body: %w", err)
+	return &requestScope{retry: defaultRetryPolicy}
+}
+
+// transport implements the livedns.HTTPDoer interface. It limits the rate of
+// requests made with a single credential and retries requests that fail in a
+// way that is known to be transient, logging every attempt.
+type transport struct {
+	client  *http.Client
+	limiter *rateLimiter
+}
+
+// Do implements the livedns.HTTPDoer interface. The response to the last
+// attempt is returned.
+func (t *transport) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	scope := requestScopeFrom(ctx)
+	log := challengeLogFrom(ctx)
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("error rewinding request body: %w", err)
+			}
+			req.Body = body
+		}
+		throttled, err := t.limiter.wait(ctx)
+		scope.metrics.observeThrottle(scope.operation, throttled)
+		if err != nil {
+			return nil, fmt.Errorf("error waiting for rate limit: %w", err)
+		}
+		attemptStart := time.Now()
+		res, err := t.client.Do(req) // nolint: bodyclose
+		var header http.Header
+		scope.status = 0
+		if res != nil {
+			scope.status, header = res.StatusCode, res.Header
+		}
+		log.logAPIRequest(req.Method, req.URL.Path, attempt, scope.status, time.Since(attemptStart), err)
+		t.limiter.observe(scope.status, header)
+		if attempt >= scope.retry.maxAttempts ||
+			!isRetryable(req.Method, scope.status, err) {
+			return res, err
+		}
+		wait := scope.retry.backoff(attempt + 1)
+		if retryAfter, ok := parseRetryAfter(
+			header.Get("Retry-After"),
+			time.Now(),
+		); ok {
+			wait = retryAfter
+		}
+		if time.Since(start)+wait > scope.retry.maxElapsed {
+			// The next attempt could not start within the time budget, so we may
+			// as well give up now.
+			return res, err
+		}
+		if res != nil {
+			// Drain the response so its connection can be reused
+			_, _ = io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+		if sleepErr := sleep(ctx, wait); sleepErr != nil {
+			if err == nil {
+				err = sleepErr
+			}
+			return nil, err
+		}
 	}
-	return res.StatusCode, bodyBytes, nil
 }
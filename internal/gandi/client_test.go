@@ -1,14 +1,19 @@
 package gandi
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/krancovia/cert-manager-webhook-gandi/pkg/livedns"
 )
 
 const (
@@ -17,20 +22,70 @@ const (
 	testZone      = "example.com"
 	testEntryName = "_acme-challenge"
 	testToken     = "fakeToken"
+	testTTL       = 600
 )
 
 func TestNewClient(t *testing.T) {
-	c := newClient(testToken)
+	cfg := Config{}
+	cfg.Default()
+	c := newClient(cfg, testToken, http.DefaultClient)
 	require.NotNil(t, c)
-	require.Equal(t, testToken, c.accessToken)
-	require.NotNil(t, c.client)
+	require.IsType(t, &livedns.Client{}, c.api)
+	require.NotNil(t, c.transport)
+	require.Same(t, http.DefaultClient, c.transport.client)
+	require.Equal(t, defaultRetryPolicy, c.retry)
+}
+
+func TestClientAuthorization(t *testing.T) {
+	testCases := []struct {
+		name           string
+		credentialType CredentialType
+		expected       string
+	}{
+		{
+			name:     "default",
+			expected: fmt.Sprintf("Bearer %s", testToken),
+		},
+		{
+			name:           "personal access token",
+			credentialType: CredentialTypePAT,
+			expected:       fmt.Sprintf("Bearer %s", testToken),
+		},
+		{
+			name:           "legacy API key",
+			credentialType: CredentialTypeAPIKey,
+			expected:       fmt.Sprintf("Apikey %s", testToken),
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc(domainsPath, func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, testCase.expected, r.Header.Get("Authorization"))
+				w.WriteHeader(http.StatusNoContent)
+			})
+			srv := httptest.NewServer(mux)
+			t.Cleanup(srv.Close)
+			c := newClient(
+				Config{
+					CredentialSource: CredentialSource{
+						CredentialType: testCase.credentialType,
+					},
+					APIEndpoint: srv.URL,
+				},
+				testToken,
+				http.DefaultClient,
+			)
+			require.NoError(t, c.deleteTxtRecord(context.Background(), testZone, testEntryName))
+		})
+	}
 }
 
-func TestGetTxtRecordValues(t *testing.T) {
+func TestGetTxtRecord(t *testing.T) {
 	testCases := []struct {
 		name       string
 		setup      func(*testing.T) string
-		assertions func(*testing.T, []string, error)
+		assertions func(*testing.T, *livedns.RRSet, error)
 	}{
 		{
 			name: "not found",
@@ -43,9 +98,9 @@ func TestGetTxtRecordValues(t *testing.T) {
 				t.Cleanup(srv.Close)
 				return srv.URL
 			},
-			assertions: func(t *testing.T, values []string, err error) {
+			assertions: func(t *testing.T, rrs *livedns.RRSet, err error) {
 				require.NoError(t, err)
-				require.Empty(t, values)
+				require.Nil(t, rrs)
 			},
 		},
 		{
@@ -59,10 +114,36 @@ func TestGetTxtRecordValues(t *testing.T) {
 				t.Cleanup(srv.Close)
 				return srv.URL
 			},
-			assertions: func(t *testing.T, values []string, err error) {
+			assertions: func(t *testing.T, rrs *livedns.RRSet, err error) {
 				require.ErrorContains(t, err, "unexpected HTTP status")
 				require.ErrorContains(t, err, strconv.Itoa(http.StatusBadRequest))
-				require.Empty(t, values)
+				require.Nil(t, rrs)
+			},
+		},
+		{
+			name: "Gandi error",
+			setup: func(t *testing.T) string {
+				mux := http.NewServeMux()
+				mux.HandleFunc(domainsPath, func(w http.ResponseWriter, _ *http.Request) {
+					w.WriteHeader(http.StatusForbidden)
+					_, err := w.Write([]byte(`{
+						"code": 403,
+						"message": "Access was denied to this resource.",
+						"object": "HTTPForbidden",
+						"cause": "Forbidden"
+					}`))
+					require.NoError(t, err)
+				})
+				srv := httptest.NewServer(mux)
+				t.Cleanup(srv.Close)
+				return srv.URL
+			},
+			assertions: func(t *testing.T, rrs *livedns.RRSet, err error) {
+				require.True(t, livedns.IsForbidden(err))
+				apiErr := &livedns.APIError{}
+				require.ErrorAs(t, err, &apiErr)
+				require.Equal(t, "Access was denied to this resource.", apiErr.Message)
+				require.Nil(t, rrs)
 			},
 		},
 		{
@@ -85,7 +166,10 @@ func TestGetTxtRecordValues(t *testing.T) {
 						r.Header.Get("Authorization"),
 					)
 					_, err := w.Write([]byte(`{
-						"rrset_values": ["fakeValue", "anotherFakeValue"]
+						"rrset_type": "TXT",
+						"rrset_ttl": 600,
+						"rrset_name": "_acme-challenge",
+						"rrset_values": ["\"fakeValue\"", "anotherFakeValue"]
 					}`))
 					require.NoError(t, err)
 				})
@@ -93,19 +177,20 @@ func TestGetTxtRecordValues(t *testing.T) {
 				t.Cleanup(srv.Close)
 				return srv.URL
 			},
-			assertions: func(t *testing.T, values []string, err error) {
+			assertions: func(t *testing.T, rrs *livedns.RRSet, err error) {
 				require.NoError(t, err)
-				require.Equal(t, []string{"fakeValue", "anotherFakeValue"}, values)
+				require.Equal(t, testTTL, rrs.TTL)
+				// Quotes should have been removed
+				require.Equal(t, []string{"fakeValue", "anotherFakeValue"}, rrs.Values)
 			},
 		},
 	}
 	for _, testCase := range testCases {
 		t.Run(testCase.name, func(t *testing.T) {
 			baseURL := testCase.setup(t)
-			c := newClient(testToken)
-			c.baseURL = baseURL
-			values, err := c.getTxtRecordValues(testZone, testEntryName)
-			testCase.assertions(t, values, err)
+			c := newClient(Config{APIEndpoint: baseURL}, testToken, http.DefaultClient)
+			rrs, err := c.getTxtRecord(context.Background(), testZone, testEntryName)
+			testCase.assertions(t, rrs, err)
 		})
 	}
 }
@@ -163,6 +248,7 @@ func TestCreateTxtRecord(t *testing.T) {
 					for _, value := range testValues {
 						require.Contains(t, body, value)
 					}
+					require.Contains(t, body, fmt.Sprintf(`"rrset_ttl":%d`, testTTL))
 					w.WriteHeader(http.StatusCreated)
 				})
 				srv := httptest.NewServer(mux)
@@ -177,11 +263,10 @@ func TestCreateTxtRecord(t *testing.T) {
 	for _, testCase := range testCases {
 		t.Run(testCase.name, func(t *testing.T) {
 			baseURL := testCase.setup(t)
-			c := newClient(testToken)
-			c.baseURL = baseURL
+			c := newClient(Config{APIEndpoint: baseURL}, testToken, http.DefaultClient)
 			testCase.assertions(
 				t,
-				c.createTxtRecord(testZone, testEntryName, testValues),
+				c.createTxtRecord(context.Background(), testZone, testEntryName, testTTL, testValues),
 			)
 		})
 	}
@@ -240,6 +325,7 @@ func TestUpdateTxtRecord(t *testing.T) {
 					for _, value := range testValues {
 						require.Contains(t, body, value)
 					}
+					require.Contains(t, body, fmt.Sprintf(`"rrset_ttl":%d`, testTTL))
 					w.WriteHeader(http.StatusCreated)
 				})
 				srv := httptest.NewServer(mux)
@@ -254,16 +340,133 @@ func TestUpdateTxtRecord(t *testing.T) {
 	for _, testCase := range testCases {
 		t.Run(testCase.name, func(t *testing.T) {
 			baseURL := testCase.setup(t)
-			c := newClient(testToken)
-			c.baseURL = baseURL
+			c := newClient(Config{APIEndpoint: baseURL}, testToken, http.DefaultClient)
 			testCase.assertions(
 				t,
-				c.updateTxtRecord(testZone, testEntryName, testValues),
+				c.updateTxtRecord(context.Background(), testZone, testEntryName, testTTL, testValues),
 			)
 		})
 	}
 }
 
+func TestDomainExists(t *testing.T) {
+	testCases := []struct {
+		name       string
+		status     int
+		assertions func(*testing.T, bool, error)
+	}{
+		{
+			name:   "domain exists",
+			status: http.StatusOK,
+			assertions: func(t *testing.T, exists bool, err error) {
+				require.NoError(t, err)
+				require.True(t, exists)
+			},
+		},
+		{
+			name:   "domain not found",
+			status: http.StatusNotFound,
+			assertions: func(t *testing.T, exists bool, err error) {
+				require.NoError(t, err)
+				require.False(t, exists)
+			},
+		},
+		{
+			name:   "domain belongs to someone else",
+			status: http.StatusForbidden,
+			assertions: func(t *testing.T, exists bool, err error) {
+				require.NoError(t, err)
+				require.False(t, exists)
+			},
+		},
+		{
+			name:   "unexpected status code",
+			status: http.StatusUnauthorized,
+			assertions: func(t *testing.T, _ bool, err error) {
+				require.True(t, livedns.IsUnauthorized(err))
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc(domainsPath, func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, http.MethodGet, r.Method)
+				require.Equal(t, domainsPath+testZone, r.URL.Path)
+				w.WriteHeader(testCase.status)
+			})
+			srv := httptest.NewServer(mux)
+			t.Cleanup(srv.Close)
+			c := newClient(Config{APIEndpoint: srv.URL}, testToken, http.DefaultClient)
+			exists, err := c.domainExists(context.Background(), testZone)
+			testCase.assertions(t, exists, err)
+		})
+	}
+}
+
+func TestListTxtRecords(t *testing.T) {
+	testCases := []struct {
+		name       string
+		status     int
+		body       string
+		assertions func(*testing.T, []livedns.RRSet, error)
+	}{
+		{
+			name:   "record sets found",
+			status: http.StatusOK,
+			body: `[{"rrset_type":"TXT","rrset_ttl":300,"rrset_name":"_acme-challenge",` +
+				`"rrset_values":["\"foo\"","\"bar\""]}]`,
+			assertions: func(t *testing.T, rrsets []livedns.RRSet, err error) {
+				require.NoError(t, err)
+				require.Equal(
+					t,
+					[]livedns.RRSet{{
+						Type:   "TXT",
+						TTL:    300,
+						Name:   testEntryName,
+						Values: []string{"foo", "bar"},
+					}},
+					rrsets,
+				)
+			},
+		},
+		{
+			name:   "no record sets",
+			status: http.StatusOK,
+			body:   `[]`,
+			assertions: func(t *testing.T, rrsets []livedns.RRSet, err error) {
+				require.NoError(t, err)
+				require.Empty(t, rrsets)
+			},
+		},
+		{
+			name:   "unexpected status code",
+			status: http.StatusForbidden,
+			body:   `{}`,
+			assertions: func(t *testing.T, _ []livedns.RRSet, err error) {
+				require.True(t, livedns.IsForbidden(err))
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc(domainsPath, func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, http.MethodGet, r.Method)
+				require.Equal(t, domainsPath+testZone+"/records", r.URL.Path)
+				require.Equal(t, "TXT", r.URL.Query().Get("rrset_type"))
+				w.WriteHeader(testCase.status)
+				_, _ = w.Write([]byte(testCase.body))
+			})
+			srv := httptest.NewServer(mux)
+			t.Cleanup(srv.Close)
+			c := newClient(Config{APIEndpoint: srv.URL}, testToken, http.DefaultClient)
+			rrsets, err := c.listTxtRecords(context.Background(), testZone)
+			testCase.assertions(t, rrsets, err)
+		})
+	}
+}
+
 func TestDeleteTxtRecord(t *testing.T) {
 	testCases := []struct {
 		name       string
@@ -320,12 +523,217 @@ func TestDeleteTxtRecord(t *testing.T) {
 	for _, testCase := range testCases {
 		t.Run(testCase.name, func(t *testing.T) {
 			baseURL := testCase.setup(t)
-			c := newClient(testToken)
-			c.baseURL = baseURL
+			c := newClient(Config{APIEndpoint: baseURL}, testToken, http.DefaultClient)
 			testCase.assertions(
 				t,
-				c.deleteTxtRecord(testZone, testEntryName),
+				c.deleteTxtRecord(context.Background(), testZone, testEntryName),
 			)
 		})
 	}
 }
+
+func TestDoRequestContextCanceled(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(domainsPath, func(_ http.ResponseWriter, r *http.Request) {
+		// Block until the client gives up
+		<-r.Context().Done()
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	c := newClient(Config{APIEndpoint: srv.URL}, testToken, http.DefaultClient)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := c.getTxtRecord(ctx, testZone, testEntryName)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestDoRequestRateLimited(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(domainsPath, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set(rateLimitRemainingHeader, "0")
+		w.Header().Set(rateLimitResetHeader, "30")
+		w.WriteHeader(http.StatusNotFound)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	clk := clocktesting.NewFakeClock(time.Now())
+	c := newClient(Config{APIEndpoint: srv.URL}, testToken, http.DefaultClient)
+	c.transport.limiter = newRateLimiter(clk, rateLimits{requestsPerSecond: 1, burst: 10})
+
+	_, err := c.getTxtRecord(context.Background(), testZone, testEntryName)
+	require.NoError(t, err)
+
+	// The exhausted rate limit reported by Gandi should hold back the next
+	// request until it resets
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error)
+	go func() {
+		_, getErr := c.getTxtRecord(ctx, testZone, testEntryName)
+		errs <- getErr
+	}()
+	require.Eventually(t, clk.HasWaiters, time.Second, time.Millisecond)
+	cancel()
+	require.ErrorIs(t, <-errs, context.Canceled)
+}
+
+func TestDoRequestRetries(t *testing.T) {
+	testPolicy := retryPolicy{
+		maxAttempts:    3,
+		initialBackoff: time.Millisecond,
+		maxBackoff:     10 * time.Millisecond,
+		maxElapsed:     5 * time.Second,
+	}
+	testCases := []struct {
+		name string
+		// responses is the sequence of statuses returned by the test server
+		responses  []int
+		retryAfter string
+		policy     retryPolicy
+		do         func(context.Context, *client) error
+		assertions func(t *testing.T, attempts int, elapsed time.Duration, err error)
+	}{
+		{
+			name:      "GET succeeds after transient failures",
+			responses: []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK},
+			policy:    testPolicy,
+			do: func(ctx context.Context, c *client) error {
+				_, err := c.getTxtRecord(ctx, testZone, testEntryName)
+				return err
+			},
+			assertions: func(t *testing.T, attempts int, _ time.Duration, err error) {
+				require.NoError(t, err)
+				require.Equal(t, 3, attempts)
+			},
+		},
+		{
+			name: "GET gives up after max attempts",
+			responses: []int{
+				http.StatusServiceUnavailable,
+				http.StatusServiceUnavailable,
+				http.StatusServiceUnavailable,
+				http.StatusOK,
+			},
+			policy: testPolicy,
+			do: func(ctx context.Context, c *client) error {
+				_, err := c.getTxtRecord(ctx, testZone, testEntryName)
+				return err
+			},
+			assertions: func(t *testing.T, attempts int, _ time.Duration, err error) {
+				require.ErrorContains(t, err, strconv.Itoa(http.StatusServiceUnavailable))
+				require.Equal(t, 3, attempts)
+			},
+		},
+		{
+			name:      "client errors are not retried",
+			responses: []int{http.StatusBadRequest, http.StatusOK},
+			policy:    testPolicy,
+			do: func(ctx context.Context, c *client) error {
+				return c.deleteTxtRecord(ctx, testZone, testEntryName)
+			},
+			assertions: func(t *testing.T, attempts int, _ time.Duration, err error) {
+				require.ErrorContains(t, err, strconv.Itoa(http.StatusBadRequest))
+				require.Equal(t, 1, attempts)
+			},
+		},
+		{
+			name:      "PUT is retried with its body intact",
+			responses: []int{http.StatusGatewayTimeout, http.StatusOK},
+			policy:    testPolicy,
+			do: func(ctx context.Context, c *client) error {
+				return c.updateTxtRecord(ctx, testZone, testEntryName, testTTL, []string{"fakeValue"})
+			},
+			assertions: func(t *testing.T, attempts int, _ time.Duration, err error) {
+				require.NoError(t, err)
+				require.Equal(t, 2, attempts)
+			},
+		},
+		{
+			name:      "POST is not retried when it may have been processed",
+			responses: []int{http.StatusBadGateway, http.StatusCreated},
+			policy:    testPolicy,
+			do: func(ctx context.Context, c *client) error {
+				return c.createTxtRecord(ctx, testZone, testEntryName, testTTL, []string{"fakeValue"})
+			},
+			assertions: func(t *testing.T, attempts int, _ time.Duration, err error) {
+				require.ErrorContains(t, err, strconv.Itoa(http.StatusBadGateway))
+				require.Equal(t, 1, attempts)
+			},
+		},
+		{
+			name:      "POST is retried when rate limited",
+			responses: []int{http.StatusTooManyRequests, http.StatusCreated},
+			policy:    testPolicy,
+			do: func(ctx context.Context, c *client) error {
+				return c.createTxtRecord(ctx, testZone, testEntryName, testTTL, []string{"fakeValue"})
+			},
+			assertions: func(t *testing.T, attempts int, _ time.Duration, err error) {
+				require.NoError(t, err)
+				require.Equal(t, 2, attempts)
+			},
+		},
+		{
+			name:       "Retry-After is honored",
+			responses:  []int{http.StatusTooManyRequests, http.StatusOK},
+			retryAfter: "1",
+			policy:     testPolicy,
+			do: func(ctx context.Context, c *client) error {
+				_, err := c.getTxtRecord(ctx, testZone, testEntryName)
+				return err
+			},
+			assertions: func(t *testing.T, attempts int, elapsed time.Duration, err error) {
+				require.NoError(t, err)
+				require.Equal(t, 2, attempts)
+				require.GreaterOrEqual(t, elapsed, time.Second)
+			},
+		},
+		{
+			name:       "Retry-After beyond the time budget",
+			responses:  []int{http.StatusTooManyRequests, http.StatusOK},
+			retryAfter: "60",
+			policy:     testPolicy,
+			do: func(ctx context.Context, c *client) error {
+				_, err := c.getTxtRecord(ctx, testZone, testEntryName)
+				return err
+			},
+			assertions: func(t *testing.T, attempts int, elapsed time.Duration, err error) {
+				require.ErrorContains(t, err, strconv.Itoa(http.StatusTooManyRequests))
+				require.Equal(t, 1, attempts)
+				require.Less(t, elapsed, time.Second)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var attempts int
+			var bodies []string
+			mux := http.NewServeMux()
+			mux.HandleFunc(domainsPath, func(w http.ResponseWriter, r *http.Request) {
+				defer r.Body.Close()
+				bodyBytes, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				bodies = append(bodies, string(bodyBytes))
+				status := testCase.responses[attempts]
+				attempts++
+				if testCase.retryAfter != "" && status == http.StatusTooManyRequests {
+					w.Header().Set("Retry-After", testCase.retryAfter)
+				}
+				w.WriteHeader(status)
+				if status == http.StatusOK {
+					_, err = w.Write([]byte(`{"rrset_values": []}`))
+					require.NoError(t, err)
+				}
+			})
+			srv := httptest.NewServer(mux)
+			t.Cleanup(srv.Close)
+			c := newClient(Config{APIEndpoint: srv.URL}, testToken, http.DefaultClient)
+			c.retry = testCase.policy
+			start := time.Now()
+			err := testCase.do(context.Background(), c)
+			testCase.assertions(t, attempts, time.Since(start), err)
+			// Every attempt should have carried the same body
+			for _, body := range bodies {
+				require.Equal(t, bodies[0], body)
+			}
+		})
+	}
+}
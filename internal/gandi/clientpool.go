@@ -0,0 +1,212 @@
+package gandi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"k8s.io/utils/clock"
+)
+
+const (
+	// clientIdleTimeout is the time after which a pooled client that has not
+	// been used is evicted.
+	clientIdleTimeout = 30 * time.Minute
+	// clientRequestTimeout bounds the time spent on a single attempt at a
+	// LiveDNS API request.
+	clientRequestTimeout = 30 * time.Second
+)
+
+// clientPool hands out LiveDNS API clients, reusing a single client for each
+// combination of API endpoint, credential type, and credential so that state
+// pertaining to a credential outlives individual challenges. All clients share
+// one HTTP transport, so keep-alive connections and TLS sessions are reused
+// across credentials and challenges alike.
+//
+// Clients are indexed by a hash of the credential rather than the credential
+// itself so that credentials are never retained as map keys, nor logged by
+// accident. The pool also remembers which client each credential source last
+// yielded for each API endpoint so that a client for a rotated credential is
+// evicted as soon as its replacement is first used, rather than lingering
+// until it becomes idle.
+type clientPool struct {
+	httpClient  *http.Client
+	clock       clock.Clock
+	idleTimeout time.Duration
+	logger      *slog.Logger
+	now         func() time.Time // Overridable for testing purposes
+
+	mu sync.Mutex
+	// clients is indexed by client key
+	clients map[string]*pooledClient
+	// sources maps each credential source to the key of the client for the
+	// credential most recently read from it
+	sources map[credentialSlot]string
+}
+
+// credentialSlot identifies a credential source as used with a particular API
+// endpoint. Rotation is tracked per slot so that a source used with several
+// endpoints doesn't appear to be rotated whenever the endpoint changes.
+type credentialSlot struct {
+	sourceID       string
+	apiEndpoint    string
+	credentialType CredentialType
+}
+
+// pooledClient is a client along with the bookkeeping needed to evict it.
+type pooledClient struct {
+	client   *client
+	lastUsed time.Time
+	// sources are the credential sources whose most recently read credential
+	// is the client's
+	sources map[credentialSlot]struct{}
+}
+
+func newClientPool(logger *slog.Logger) *clientPool {
+	return &clientPool{
+		httpClient: &http.Client{
+			// Each attempt at a request is traced as a child of the span of the
+			// request as a whole.
+			Transport: otelhttp.NewTransport(newTransport()),
+			Timeout:   clientRequestTimeout,
+		},
+		clock:       clock.RealClock{},
+		idleTimeout: clientIdleTimeout,
+		logger:      logger,
+		now:         time.Now,
+		clients:     map[string]*pooledClient{},
+		sources:     map[credentialSlot]string{},
+	}
+}
+
+// newTransport returns the HTTP transport shared by all pooled clients. All
+// requests go to a handful of hosts, so more idle connections per host are
+// kept than by default.
+func newTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// get returns a client for the LiveDNS API described by the given
+// configuration, which is expected to have been defaulted, authenticated by
+// the given access token, which was read from the credential source with the
+// given ID. The returned client shares its connections and any state
+// pertaining to its credential, such as its rate limiter, with every other
+// client for the same credential, but follows the retry policy of the given
+// configuration. The rate limits of the given configuration replace those of
+// any earlier one.
+func (p *clientPool) get(sourceID string, cfg Config, accessToken string) *client {
+	key := clientKey(cfg, accessToken)
+	slot := credentialSlot{
+		sourceID:       sourceID,
+		apiEndpoint:    cfg.APIEndpoint,
+		credentialType: cfg.CredentialType,
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	p.evictIdle(now)
+	pooled, ok := p.clients[key]
+	if !ok {
+		cl := newClient(cfg, accessToken, p.httpClient)
+		cl.transport.limiter = newRateLimiter(p.clock, cfg.rateLimits())
+		pooled = &pooledClient{client: cl, sources: map[credentialSlot]struct{}{}}
+		p.clients[key] = pooled
+	}
+	pooled.lastUsed = now
+	pooled.client.transport.limiter.setLimits(cfg.rateLimits())
+	if oldKey, ok := p.sources[slot]; ok && oldKey != key {
+		// The credential has been rotated
+		p.release(oldKey, slot)
+	}
+	p.sources[slot] = key
+	pooled.sources[slot] = struct{}{}
+	cl := *pooled.client
+	cl.retry = cfg.retryPolicy()
+	return &cl
+}
+
+// release removes the given credential source from the sources of the client
+// with the given key, evicting the client if no sources remain. The caller
+// must hold p.mu.
+func (p *clientPool) release(key string, slot credentialSlot) {
+	pooled, ok := p.clients[key]
+	if !ok {
+		return
+	}
+	delete(pooled.sources, slot)
+	if len(pooled.sources) == 0 {
+		delete(p.clients, key)
+		p.logger.Debug("evicted LiveDNS API client for rotated credential", "client", shortClientKey(key))
+	}
+}
+
+// evictIdle evicts clients that have not been used for longer than the idle
+// timeout. The caller must hold p.mu.
+func (p *clientPool) evictIdle(now time.Time) {
+	for key, pooled := range p.clients {
+		if now.Sub(pooled.lastUsed) <= p.idleTimeout {
+			continue
+		}
+		for slot := range pooled.sources {
+			if p.sources[slot] == key {
+				delete(p.sources, slot)
+			}
+		}
+		delete(p.clients, key)
+		p.logger.Debug("evicted idle LiveDNS API client", "client", shortClientKey(key))
+	}
+}
+
+// clientKey returns the key under which the client for the given
+// configuration and access token is pooled. It is a hash from which the
+// access token cannot be recovered.
+func clientKey(cfg Config, accessToken string) string {
+	// None of the parts can contain a NUL byte, so separating them with one
+	// keeps distinct combinations from colliding.
+	sum := sha256.Sum256(
+		[]byte(cfg.APIEndpoint + "\x00" + string(cfg.CredentialType) + "\x00" + accessToken),
+	)
+	return hex.EncodeToString(sum[:])
+}
+
+// shortClientKey returns an abbreviation of the given client key that is
+// suitable for logging.
+func shortClientKey(key string) string {
+	return key[:12]
+}
+
+// credentialSourceID returns an identifier of the given credential source for
+// a challenge with the given resource namespace. Sources with equal IDs yield
+// the same credential, barring rotation.
+func credentialSourceID(resourceNamespace string, src CredentialSource) string {
+	switch {
+	case src.APIKeyFile != "":
+		return "file:" + src.APIKeyFile
+	case src.APIKeyEnv != "":
+		return "env:" + src.APIKeyEnv
+	case src.APIKeySecretRef != nil:
+		namespace := src.APIKeySecretRef.Namespace
+		if namespace == "" {
+			namespace = resourceNamespace
+		}
+		return "secret:" + namespace + "/" + src.APIKeySecretRef.Name + "/" + src.APIKeySecretRef.Key
+	}
+	return ""
+}
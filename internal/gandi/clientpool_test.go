@@ -0,0 +1,127 @@
+package gandi
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+	"time"
+
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestClientPool(t *testing.T) {
+	const sourceID = "secret:test-namespace/gandi-credentials/api-token"
+	cfg := Config{APIEndpoint: defaultAPIEndpoint}
+	cfg.CredentialType = CredentialTypePAT
+	now := time.Now()
+	var logs bytes.Buffer
+	p := newClientPool(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	p.now = func() time.Time { return now }
+
+	cl := p.get(sourceID, cfg, "token-a")
+	require.Same(t, p.httpClient, cl.transport.client)
+	require.Len(t, p.clients, 1)
+
+	// Credentials must never be retained as keys
+	for key := range p.clients {
+		require.NotContains(t, key, "token-a")
+	}
+
+	// The same credential should reuse the pooled client, but with the retry
+	// policy of the given configuration
+	retryCfg := cfg
+	retryCfg.Retry = &RetryConfig{MaxAttempts: 1, MaxElapsedTime: &metav1.Duration{Duration: time.Second}}
+	cl = p.get(sourceID, retryCfg, "token-a")
+	require.Len(t, p.clients, 1)
+	require.Equal(t, 1, cl.retry.maxAttempts)
+	require.Equal(t, defaultRetryPolicy, p.clients[clientKey(cfg, "token-a")].client.retry)
+
+	// The same credential from another source should share the client
+	p.get("env:GANDI_TOKEN", cfg, "token-a")
+	require.Len(t, p.clients, 1)
+
+	// A different endpoint should get a client of its own without the source
+	// appearing to have been rotated
+	otherCfg := cfg
+	otherCfg.APIEndpoint = "https://livedns.example.com/v5/livedns"
+	p.get(sourceID, otherCfg, "token-a")
+	require.Len(t, p.clients, 2)
+	p.get(sourceID, cfg, "token-a")
+	require.Len(t, p.clients, 2)
+
+	// A rotated credential should not evict a client still used by another
+	// source...
+	p.get(sourceID, cfg, "token-b")
+	require.Len(t, p.clients, 3)
+	require.Contains(t, p.clients, clientKey(cfg, "token-a"))
+
+	// ...but should once no source uses it any longer
+	p.get("env:GANDI_TOKEN", cfg, "token-b")
+	require.Len(t, p.clients, 2)
+	require.NotContains(t, p.clients, clientKey(cfg, "token-a"))
+	require.Contains(t, p.clients, clientKey(cfg, "token-b"))
+
+	// Idle clients should be evicted
+	now = now.Add(clientIdleTimeout / 2)
+	p.get(sourceID, cfg, "token-b")
+	now = now.Add(clientIdleTimeout/2 + time.Second)
+	p.get(sourceID, cfg, "token-b")
+	require.Len(t, p.clients, 1)
+	require.Contains(t, p.clients, clientKey(cfg, "token-b"))
+	require.Len(t, p.sources, 2)
+
+	// Evictions should be logged through the pool's logger
+	require.Contains(t, logs.String(), "evicted LiveDNS API client for rotated credential")
+	require.Contains(t, logs.String(), "evicted idle LiveDNS API client")
+}
+
+func TestCredentialSourceID(t *testing.T) {
+	testCases := []struct {
+		name string
+		src  CredentialSource
+		id   string
+	}{
+		{
+			name: "Secret in resource namespace",
+			src: CredentialSource{
+				APIKeySecretRef: &SecretKeySelector{
+					SecretKeySelector: cmmeta.SecretKeySelector{
+						LocalObjectReference: cmmeta.LocalObjectReference{Name: "gandi-credentials"},
+						Key:                  "api-token",
+					},
+				},
+			},
+			id: "secret:test-namespace/gandi-credentials/api-token",
+		},
+		{
+			name: "Secret in other namespace",
+			src: CredentialSource{
+				APIKeySecretRef: &SecretKeySelector{
+					SecretKeySelector: cmmeta.SecretKeySelector{
+						LocalObjectReference: cmmeta.LocalObjectReference{Name: "gandi-credentials"},
+						Key:                  "api-token",
+					},
+					Namespace: "other-namespace",
+				},
+			},
+			id: "secret:other-namespace/gandi-credentials/api-token",
+		},
+		{
+			name: "file",
+			src:  CredentialSource{APIKeyFile: "/var/run/secrets/gandi/token"},
+			id:   "file:/var/run/secrets/gandi/token",
+		},
+		{
+			name: "environment variable",
+			src:  CredentialSource{APIKeyEnv: "GANDI_TOKEN"},
+			id:   "env:GANDI_TOKEN",
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.id, credentialSourceID("test-namespace", testCase.src))
+		})
+	}
+}
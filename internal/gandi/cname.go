@@ -0,0 +1,168 @@
+package gandi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/krancovia/cert-manager-webhook-gandi/pkg/livedns"
+)
+
+// cnameLookup discovers CNAME records and the zones hosting DNS names.
+type cnameLookup interface {
+	// lookupCNAME returns the fully qualified target of the CNAME record at
+	// the given fully qualified name, or an empty string if there is none.
+	lookupCNAME(ctx context.Context, fqdn string) (string, error)
+	// findZone returns the name, without a trailing dot, of the zone hosting
+	// the given fully qualified name.
+	findZone(ctx context.Context, fqdn string) (string, error)
+}
+
+// followCNAMEs follows the chain of CNAME records starting at the given fully
+// qualified name and returns the fully qualified name at its end. It fails if
+// the chain loops or is longer than maxDepth.
+func followCNAMEs(
+	ctx context.Context,
+	lookup cnameLookup,
+	fqdn string,
+	maxDepth int,
+) (string, error) {
+	current := normalizeFQDN(fqdn)
+	chain := []string{current}
+	seen := map[string]struct{}{current: {}}
+	for {
+		target, err := lookup.lookupCNAME(ctx, current)
+		if err != nil {
+			return "", fmt.Errorf("error looking up CNAME record for %q: %w", current, err)
+		}
+		if target == "" {
+			return current, nil
+		}
+		target = normalizeFQDN(target)
+		chain = append(chain, target)
+		if _, ok := seen[target]; ok {
+			return "", fmt.Errorf("CNAME loop detected: %s", strings.Join(chain, " -> "))
+		}
+		if len(chain)-1 > maxDepth {
+			return "", fmt.Errorf(
+				"CNAME chain starting at %q exceeds the maximum depth of %d",
+				chain[0], maxDepth,
+			)
+		}
+		seen[target] = struct{}{}
+		current = target
+	}
+}
+
+// normalizeFQDN returns the given name in lowercase and with a trailing dot so
+// that equivalent names compare equal.
+func normalizeFQDN(name string) string {
+	return dns.Fqdn(strings.ToLower(name))
+}
+
+// dnsCNAMELookup is a cnameLookup that queries recursive nameservers.
+type dnsCNAMELookup struct {
+	resolver *dnsResolver
+}
+
+// newDNSCNAMELookup returns a dnsCNAMELookup that queries the given recursive
+// nameservers or, if there are none, those in /etc/resolv.conf.
+func newDNSCNAMELookup(nameservers []string) (*dnsCNAMELookup, error) {
+	resolver, err := newRecursiveDNSResolver(nameservers)
+	if err != nil {
+		return nil, err
+	}
+	return &dnsCNAMELookup{resolver: resolver}, nil
+}
+
+func (l *dnsCNAMELookup) lookupCNAME(ctx context.Context, fqdn string) (string, error) {
+	res, err := l.resolver.query(ctx, fqdn, dns.TypeCNAME)
+	if err != nil {
+		return "", err
+	}
+	for _, rr := range res.Answer {
+		if cname, ok := rr.(*dns.CNAME); ok && strings.EqualFold(cname.Hdr.Name, fqdn) {
+			return cname.Target, nil
+		}
+	}
+	return "", nil
+}
+
+func (l *dnsCNAMELookup) findZone(ctx context.Context, fqdn string) (string, error) {
+	return l.resolver.findZone(ctx, fqdn)
+}
+
+// apiCNAMELookup is a cnameLookup that queries the Gandi LiveDNS API. Only
+// zones for which credentials are configured are considered.
+type apiCNAMELookup struct {
+	// clientFor returns a client authenticated by the credential configured
+	// for the given zone. It returns an error wrapping errNoCredentials if there
+	// is none.
+	clientFor func(ctx context.Context, zone string) (*client, error)
+}
+
+func (l *apiCNAMELookup) lookupCNAME(ctx context.Context, fqdn string) (string, error) {
+	zone, err := l.findZone(ctx, fqdn)
+	if err != nil {
+		return "", err
+	}
+	cl, err := l.clientFor(ctx, zone)
+	if err != nil {
+		return "", err
+	}
+	rrs, err := cl.getRecord(ctx, zone, relativeName(fqdn, zone), livedns.TypeCNAME)
+	if err != nil {
+		return "", explainAPIError(err, zone)
+	}
+	if rrs == nil || len(rrs.Values) == 0 {
+		return "", nil
+	}
+	target := rrs.Values[0]
+	if !strings.HasSuffix(target, ".") {
+		// Gandi permits targets relative to the zone
+		target = fmt.Sprintf("%s.%s.", target, zone)
+	}
+	return target, nil
+}
+
+// findZone returns the longest suffix of the given name, excluding the
+// top-level domain alone, that is a domain managed by Gandi LiveDNS.
+func (l *apiCNAMELookup) findZone(ctx context.Context, fqdn string) (string, error) {
+	labels := strings.Split(normalizeZone(fqdn), ".")
+	for i := range len(labels) - 1 {
+		candidate := strings.Join(labels[i:], ".")
+		cl, err := l.clientFor(ctx, candidate)
+		if errors.Is(err, errNoCredentials) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		exists, err := cl.domainExists(ctx, candidate)
+		if err != nil {
+			return "", explainAPIError(err, candidate)
+		}
+		if exists {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf(
+		"no domain managed by Gandi LiveDNS and with configured credentials "+
+			"contains %q",
+		fqdn,
+	)
+}
+
+// relativeName returns the given fully qualified name relative to the given
+// zone, using "@" for the zone's apex as Gandi does.
+func relativeName(fqdn string, zone string) string {
+	name := normalizeZone(fqdn)
+	zone = normalizeZone(zone)
+	if name == zone {
+		return "@"
+	}
+	return strings.TrimSuffix(name, "."+zone)
+}
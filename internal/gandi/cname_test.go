@@ -0,0 +1,218 @@
+package gandi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/krancovia/cert-manager-webhook-gandi/pkg/livedns"
+)
+
+// mapCNAMELookup is a cnameLookup backed by a map of CNAME records.
+type mapCNAMELookup map[string]string
+
+func (m mapCNAMELookup) lookupCNAME(_ context.Context, fqdn string) (string, error) {
+	if target, ok := m[fqdn]; ok {
+		if target == "" {
+			return "", errors.New("something went wrong")
+		}
+		return target, nil
+	}
+	return "", nil
+}
+
+func (m mapCNAMELookup) findZone(context.Context, string) (string, error) {
+	return testZone, nil
+}
+
+func TestFollowCNAMEs(t *testing.T) {
+	testCases := []struct {
+		name       string
+		records    mapCNAMELookup
+		assertions func(*testing.T, string, error)
+	}{
+		{
+			name: "no CNAME",
+			assertions: func(t *testing.T, target string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "_acme-challenge.example.com.", target)
+			},
+		},
+		{
+			name: "chain",
+			records: mapCNAMELookup{
+				"_acme-challenge.example.com.": "Example.NET",
+				"example.net.":                 "validation.example.org.",
+			},
+			assertions: func(t *testing.T, target string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "validation.example.org.", target)
+			},
+		},
+		{
+			name: "loop",
+			records: mapCNAMELookup{
+				"_acme-challenge.example.com.": "a.example.net.",
+				"a.example.net.":               "b.example.net.",
+				"b.example.net.":               "a.example.net.",
+			},
+			assertions: func(t *testing.T, _ string, err error) {
+				require.ErrorContains(
+					t,
+					err,
+					"CNAME loop detected: _acme-challenge.example.com. -> "+
+						"a.example.net. -> b.example.net. -> a.example.net.",
+				)
+			},
+		},
+		{
+			name: "chain at maximum depth",
+			records: mapCNAMELookup{
+				"_acme-challenge.example.com.": "1.example.net.",
+				"1.example.net.":               "2.example.net.",
+				"2.example.net.":               "3.example.net.",
+			},
+			assertions: func(t *testing.T, target string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "3.example.net.", target)
+			},
+		},
+		{
+			name: "chain too deep",
+			records: mapCNAMELookup{
+				"_acme-challenge.example.com.": "1.example.net.",
+				"1.example.net.":               "2.example.net.",
+				"2.example.net.":               "3.example.net.",
+				"3.example.net.":               "4.example.net.",
+			},
+			assertions: func(t *testing.T, _ string, err error) {
+				require.ErrorContains(t, err, "exceeds the maximum depth of 3")
+			},
+		},
+		{
+			name: "lookup error",
+			records: mapCNAMELookup{
+				"_acme-challenge.example.com.": "a.example.net.",
+				"a.example.net.":               "",
+			},
+			assertions: func(t *testing.T, _ string, err error) {
+				require.ErrorContains(t, err, `error looking up CNAME record for "a.example.net."`)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			target, err := followCNAMEs(
+				context.Background(),
+				testCase.records,
+				"_acme-challenge.Example.com",
+				3,
+			)
+			testCase.assertions(t, target, err)
+		})
+	}
+}
+
+func TestDNSCNAMELookup(t *testing.T) {
+	f := newFakeDNS(t)
+	f.add(
+		t,
+		testSOA("example.com"),
+		testSOA("validation.example.net"),
+		"_acme-challenge.example.com. 300 IN CNAME _acme-challenge.validation.example.net.",
+	)
+	l, err := newDNSCNAMELookup([]string{f.addr})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	target, err := l.lookupCNAME(ctx, "_acme-challenge.example.com.")
+	require.NoError(t, err)
+	require.Equal(t, "_acme-challenge.validation.example.net.", target)
+
+	target, err = l.lookupCNAME(ctx, "_acme-challenge.validation.example.net.")
+	require.NoError(t, err)
+	require.Empty(t, target)
+
+	zone, err := l.findZone(ctx, "_acme-challenge.validation.example.net.")
+	require.NoError(t, err)
+	require.Equal(t, "validation.example.net", zone)
+
+	zone, err = l.findZone(ctx, "example.com.")
+	require.NoError(t, err)
+	require.Equal(t, "example.com", zone)
+
+	_, err = l.findZone(ctx, "example.org.")
+	require.ErrorContains(t, err, "no SOA record found")
+}
+
+func TestDNSCNAMELookupFailover(t *testing.T) {
+	f := newFakeDNS(t)
+	f.add(t, testSOA("example.com"))
+	// The first nameserver doesn't exist, so the second should be consulted
+	l, err := newDNSCNAMELookup([]string{"127.0.0.1:1", f.addr})
+	require.NoError(t, err)
+	l.resolver.udp.Timeout = 100 * time.Millisecond
+	zone, err := l.findZone(context.Background(), "example.com.")
+	require.NoError(t, err)
+	require.Equal(t, "example.com", zone)
+}
+
+func TestAPICNAMELookup(t *testing.T) {
+	f := newFakeLiveDNS(t)
+	f.addDomain("example.com")
+	f.addDomain("validation.example.net")
+	f.addDomain("unconfigured.example.org")
+	f.set("example.com", livedns.RRSet{
+		Type:   "CNAME",
+		TTL:    minTTL,
+		Name:   testEntryName,
+		Values: []string{"_acme-challenge.validation.example.net."},
+	})
+	f.set("validation.example.net", livedns.RRSet{
+		Type:   "CNAME",
+		TTL:    minTTL,
+		Name:   "relative",
+		Values: []string{"_acme-challenge"},
+	})
+	l := &apiCNAMELookup{
+		clientFor: func(_ context.Context, zone string) (*client, error) {
+			if zone == "unconfigured.example.org" {
+				return nil, fmt.Errorf("%w for zone %q", errNoCredentials, zone)
+			}
+			c := newClient(Config{APIEndpoint: f.url}, testToken, http.DefaultClient)
+			return c, nil
+		},
+	}
+	ctx := context.Background()
+
+	target, err := l.lookupCNAME(ctx, "_acme-challenge.example.com.")
+	require.NoError(t, err)
+	require.Equal(t, "_acme-challenge.validation.example.net.", target)
+
+	target, err = l.lookupCNAME(ctx, "relative.validation.example.net.")
+	require.NoError(t, err)
+	require.Equal(t, "_acme-challenge.validation.example.net.", target)
+
+	target, err = l.lookupCNAME(ctx, "_acme-challenge.validation.example.net.")
+	require.NoError(t, err)
+	require.Empty(t, target)
+
+	zone, err := l.findZone(ctx, "a.b.validation.example.net.")
+	require.NoError(t, err)
+	require.Equal(t, "validation.example.net", zone)
+
+	// Domains without credentials are not considered
+	_, err = l.findZone(ctx, "_acme-challenge.unconfigured.example.org.")
+	require.ErrorContains(t, err, "no domain managed by Gandi LiveDNS")
+}
+
+func TestRelativeName(t *testing.T) {
+	require.Equal(t, "_acme-challenge", relativeName("_acme-challenge.example.com.", "example.com"))
+	require.Equal(t, "a.b", relativeName("A.b.Example.com", "example.com."))
+	require.Equal(t, "@", relativeName("example.com.", "example.com"))
+}
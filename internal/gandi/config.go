@@ -0,0 +1,676 @@
+package gandi
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	kjson "sigs.k8s.io/json"
+)
+
+// CredentialType identifies the kind of credential used to authenticate to the
+// Gandi LiveDNS API.
+type CredentialType string
+
+const (
+	// CredentialTypePAT denotes a Gandi personal access token. This is the
+	// default.
+	CredentialTypePAT CredentialType = "pat"
+	// CredentialTypeAPIKey denotes a legacy (deprecated) Gandi API key.
+	CredentialTypeAPIKey CredentialType = "apikey"
+)
+
+// defaultAPIEndpoint is the base URL of the official Gandi LiveDNS API.
+const defaultAPIEndpoint = "https://api.gandi.net/v5/livedns"
+
+const (
+	// minTTL is the minimum TTL, in seconds, permitted by Gandi. It is also the
+	// default TTL of challenge records.
+	minTTL = 300
+	// maxTTL is the maximum TTL, in seconds, permitted for challenge records.
+	// Challenge records are short-lived, so there is never a good reason for
+	// resolvers to cache them for longer than this.
+	maxTTL = 86400
+)
+
+// Config represents the solver configuration found in the webhook section of
+// an Issuer or ClusterIssuer's DNS-01 solver.
+type Config struct {
+	// CredentialSource is the source of the credential used for any zone not
+	// selected by Zones. It is required unless Zones is set, in which case it
+	// is an optional default.
+	CredentialSource `json:",inline"`
+	// Zones optionally selects different credentials for different zones, for
+	// instance because they belong to different Gandi organizations. Selectors
+	// are evaluated in order and the first to match a zone wins.
+	Zones []ZoneCredentials `json:"zones,omitempty"`
+	// APIEndpoint optionally overrides the base URL of the Gandi LiveDNS API. It
+	// must be an absolute https URL unless AllowInsecureAPIEndpoint is true.
+	APIEndpoint string `json:"apiEndpoint,omitempty"`
+	// AllowInsecureAPIEndpoint permits APIEndpoint to be a plain http URL. This
+	// exposes the credential to anyone able to observe the traffic and should
+	// only ever be used with a trusted proxy.
+	AllowInsecureAPIEndpoint bool `json:"allowInsecureAPIEndpoint,omitempty"`
+	// TTL is the TTL, in seconds, of any TXT record created by the solver. It
+	// must be between 300 (the default) and 86400. It does not apply to existing
+	// records to which a challenge key is added; these retain their TTL.
+	TTL int `json:"ttl,omitempty"`
+	// Retry optionally overrides the default policy for retrying failed LiveDNS
+	// API requests.
+	Retry *RetryConfig `json:"retry,omitempty"`
+	// RateLimit optionally overrides the default limits on the rate at which
+	// LiveDNS API requests are made with each credential.
+	RateLimit *RateLimitConfig `json:"rateLimit,omitempty"`
+	// CNAME, if set, makes the solver follow any chain of CNAME records at the
+	// challenge name and write the challenge record into the zone hosting the
+	// end of the chain instead.
+	CNAME *CNAMEConfig `json:"cname,omitempty"`
+	// Propagation, if set, makes Present wait until the challenge record is
+	// served by all of the zone's authoritative nameservers, and CleanUp wait
+	// until it no longer is, before returning.
+	Propagation *PropagationConfig `json:"propagation,omitempty"`
+}
+
+// CredentialSource specifies where to find the credential used to
+// authenticate to the Gandi LiveDNS API. Exactly one of APIKeySecretRef,
+// APIKeyFile, and APIKeyEnv may be set.
+type CredentialSource struct {
+	// APIKeySecretRef references the key of a Secret containing the
+	// credential.
+	APIKeySecretRef *SecretKeySelector `json:"apiKeySecretRef,omitempty"`
+	// APIKeyFile is the absolute path of a file within the webhook's Pod
+	// containing the credential, such as one mounted by the Secrets Store CSI
+	// driver. The file is re-read whenever it changes. It may only be used by
+	// ClusterIssuers.
+	APIKeyFile string `json:"apiKeyFile,omitempty"`
+	// APIKeyEnv is the name of an environment variable of the webhook's
+	// container containing the credential. It may only be used by
+	// ClusterIssuers.
+	APIKeyEnv string `json:"apiKeyEnv,omitempty"`
+	// CredentialType is the kind of credential referenced by APIKeySecretRef,
+	// APIKeyFile, or APIKeyEnv. It may be either "pat" (the default) or
+	// "apikey".
+	CredentialType CredentialType `json:"credentialType,omitempty"`
+}
+
+// ZoneCredentials selects the credential for one or more zones. Exactly one of
+// Zone and ZoneSuffix must be set.
+type ZoneCredentials struct {
+	// Zone selects exactly the named zone.
+	Zone string `json:"zone,omitempty"`
+	// ZoneSuffix selects the named zone and every zone beneath it.
+	ZoneSuffix string `json:"zoneSuffix,omitempty"`
+	// CredentialSource is the source of the credential for the selected
+	// zones.
+	CredentialSource `json:",inline"`
+}
+
+// SecretKeySelector references a key of a Secret. Unlike
+// cmmeta.SecretKeySelector, it may also name the Secret's namespace.
+type SecretKeySelector struct {
+	cmmeta.SecretKeySelector `json:",inline"`
+	// Namespace optionally names the namespace of the referenced Secret. It is
+	// honored only for ClusterIssuers. Issuers may only reference Secrets in
+	// their own namespace. If empty, the Secret is looked up in the Issuer's
+	// namespace or, for a ClusterIssuer, in cert-manager's cluster resource
+	// namespace.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// RetryConfig is the user-facing representation of a retryPolicy.
+type RetryConfig struct {
+	// MaxAttempts is the maximum number of attempts made for a single LiveDNS
+	// API request, including the first one. A value of 1 disables retries.
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+	// MaxElapsedTime bounds the total time spent on a single LiveDNS API
+	// request, including all retries and the delays between them.
+	MaxElapsedTime *metav1.Duration `json:"maxElapsedTime,omitempty"`
+}
+
+// RateLimitConfig is the user-facing representation of rateLimits. Requests
+// made with a credential are limited as configured by whichever Issuer most
+// recently used it, so Issuers sharing a credential should agree on limits.
+type RateLimitConfig struct {
+	// RequestsPerSecond is the sustained rate at which LiveDNS API requests may
+	// be made with a single credential.
+	RequestsPerSecond float64 `json:"requestsPerSecond,omitempty"`
+	// Burst is the number of LiveDNS API requests that may be made at once
+	// with a single credential after a period of inactivity.
+	Burst int `json:"burst,omitempty"`
+}
+
+// CNAMEResolver identifies the means by which CNAME records are resolved.
+type CNAMEResolver string
+
+const (
+	// CNAMEResolverDNS resolves CNAME records, and the zones hosting their
+	// targets, using DNS. This is the default.
+	CNAMEResolverDNS CNAMEResolver = "dns"
+	// CNAMEResolverAPI resolves CNAME records, and the zones hosting their
+	// targets, using the Gandi LiveDNS API. Only zones for which credentials are
+	// configured are considered, so every link in the chain must be hosted by
+	// Gandi.
+	CNAMEResolverAPI CNAMEResolver = "api"
+)
+
+// defaultMaxCNAMEDepth is the default maximum number of CNAME records followed
+// from a challenge name.
+const defaultMaxCNAMEDepth = 8
+
+// CNAMEConfig configures how CNAME records at challenge names are followed.
+type CNAMEConfig struct {
+	// Resolver is the means by which CNAME records are resolved. It may be
+	// either "dns" (the default) or "api".
+	Resolver CNAMEResolver `json:"resolver,omitempty"`
+	// MaxDepth is the maximum number of CNAME records followed from a challenge
+	// name. It defaults to 8.
+	MaxDepth int `json:"maxDepth,omitempty"`
+	// Nameservers optionally lists the recursive nameservers, as host or
+	// host:port, queried by the "dns" resolver. If empty, those in the
+	// webhook's /etc/resolv.conf are used.
+	Nameservers []string `json:"nameservers,omitempty"`
+}
+
+const (
+	// defaultPropagationTimeout is the default maximum time spent waiting for a
+	// change to propagate. Waiting also counts against the challenge timeout,
+	// so it leaves some of that for the change itself.
+	defaultPropagationTimeout = 45 * time.Second
+	// defaultPropagationPollInterval is the default time between queries to
+	// any authoritative nameserver that has yet to serve a change.
+	defaultPropagationPollInterval = 2 * time.Second
+)
+
+// PropagationConfig configures waiting for changes to challenge records to
+// propagate to the authoritative nameservers of their zones.
+type PropagationConfig struct {
+	// Timeout is the maximum time spent waiting for a change to propagate. It
+	// defaults to 45s and must be less than the 1m allowed for presenting or
+	// cleaning up a challenge as a whole, which also bounds the wait. If either
+	// expires, Present or CleanUp fails and is retried later by cert-manager.
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// PollInterval is the time between queries to any nameserver that has yet
+	// to serve a change. It defaults to 2s.
+	PollInterval *metav1.Duration `json:"pollInterval,omitempty"`
+	// Resolvers optionally lists the recursive nameservers, as host or
+	// host:port, used to look up the authoritative nameservers of a zone. If
+	// empty, those in the webhook's /etc/resolv.conf are used.
+	Resolvers []string `json:"resolvers,omitempty"`
+	// Nameservers optionally overrides the authoritative nameservers, as host or
+	// host:port, that are polled. If empty, they are looked up from the zone's
+	// NS records.
+	Nameservers []string `json:"nameservers,omitempty"`
+}
+
+// loadConfig strictly decodes, defaults, and validates the solver
+// configuration from the given ChallengeRequest. Unknown and duplicate fields
+// are rejected so that typos are reported rather than silently ignored.
+func loadConfig(cr v1alpha1.ChallengeRequest) (Config, error) {
+	cfg := Config{}
+	if cr.Config == nil {
+		return cfg, errors.New("no solver config found")
+	}
+	strictErrs, err := kjson.UnmarshalStrict(cr.Config.Raw, &cfg)
+	if err == nil {
+		err = utilerrors.NewAggregate(strictErrs)
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("error decoding solver config: %w", err)
+	}
+	cfg.Default()
+	if err = cfg.Validate(); err != nil {
+		return cfg, fmt.Errorf("invalid solver config: %w", err)
+	}
+	return cfg, nil
+}
+
+// Default sets any optional field that was left unset to its default value.
+// It also normalizes APIEndpoint by removing any trailing slash.
+func (c *Config) Default() {
+	c.CredentialSource.Default()
+	for i := range c.Zones {
+		c.Zones[i].CredentialSource.Default()
+	}
+	if c.APIEndpoint == "" {
+		c.APIEndpoint = defaultAPIEndpoint
+	}
+	c.APIEndpoint = strings.TrimSuffix(c.APIEndpoint, "/")
+	if c.TTL == 0 {
+		c.TTL = minTTL
+	}
+	if c.Retry == nil {
+		c.Retry = &RetryConfig{}
+	}
+	if c.Retry.MaxAttempts == 0 {
+		c.Retry.MaxAttempts = defaultRetryPolicy.maxAttempts
+	}
+	if c.Retry.MaxElapsedTime == nil {
+		c.Retry.MaxElapsedTime = &metav1.Duration{
+			Duration: defaultRetryPolicy.maxElapsed,
+		}
+	}
+	if c.RateLimit == nil {
+		c.RateLimit = &RateLimitConfig{}
+	}
+	if c.RateLimit.RequestsPerSecond == 0 {
+		c.RateLimit.RequestsPerSecond = defaultRateLimits.requestsPerSecond
+	}
+	if c.RateLimit.Burst == 0 {
+		c.RateLimit.Burst = defaultRateLimits.burst
+	}
+	if c.CNAME != nil {
+		if c.CNAME.Resolver == "" {
+			c.CNAME.Resolver = CNAMEResolverDNS
+		}
+		if c.CNAME.MaxDepth == 0 {
+			c.CNAME.MaxDepth = defaultMaxCNAMEDepth
+		}
+	}
+	if c.Propagation != nil {
+		if c.Propagation.Timeout == nil {
+			c.Propagation.Timeout = &metav1.Duration{Duration: defaultPropagationTimeout}
+		}
+		if c.Propagation.PollInterval == nil {
+			c.Propagation.PollInterval = &metav1.Duration{
+				Duration: defaultPropagationPollInterval,
+			}
+		}
+	}
+}
+
+// Validate returns an aggregate of all problems found with the configuration,
+// or nil if there are none. Optional fields that are unset are considered
+// valid, so it is not necessary to call Default first.
+func (c Config) Validate() error {
+	errs := field.ErrorList{}
+	errs = append(errs, c.CredentialSource.validate(nil, len(c.Zones) == 0)...)
+	zonesPath := field.NewPath("zones")
+	for i, zone := range c.Zones {
+		errs = append(errs, zone.validate(zonesPath.Index(i))...)
+	}
+	if c.APIEndpoint != "" {
+		if err := validateAPIEndpoint(
+			c.APIEndpoint,
+			c.AllowInsecureAPIEndpoint,
+		); err != nil {
+			errs = append(errs, field.Invalid(
+				field.NewPath("apiEndpoint"),
+				c.APIEndpoint,
+				err.Error(),
+			))
+		}
+	}
+	if c.TTL != 0 && (c.TTL < minTTL || c.TTL > maxTTL) {
+		errs = append(errs, field.Invalid(
+			field.NewPath("ttl"),
+			c.TTL,
+			fmt.Sprintf("must be between %d and %d", minTTL, maxTTL),
+		))
+	}
+	if c.Retry != nil {
+		retryPath := field.NewPath("retry")
+		if c.Retry.MaxAttempts < 0 {
+			errs = append(errs, field.Invalid(
+				retryPath.Child("maxAttempts"),
+				c.Retry.MaxAttempts,
+				"must not be negative",
+			))
+		}
+		if c.Retry.MaxElapsedTime != nil && c.Retry.MaxElapsedTime.Duration <= 0 {
+			errs = append(errs, field.Invalid(
+				retryPath.Child("maxElapsedTime"),
+				c.Retry.MaxElapsedTime.Duration.String(),
+				"must be positive",
+			))
+		}
+	}
+	if c.RateLimit != nil {
+		rateLimitPath := field.NewPath("rateLimit")
+		if c.RateLimit.RequestsPerSecond < 0 {
+			errs = append(errs, field.Invalid(
+				rateLimitPath.Child("requestsPerSecond"),
+				c.RateLimit.RequestsPerSecond,
+				"must not be negative",
+			))
+		}
+		if c.RateLimit.Burst < 0 {
+			errs = append(errs, field.Invalid(
+				rateLimitPath.Child("burst"),
+				c.RateLimit.Burst,
+				"must not be negative",
+			))
+		}
+	}
+	if c.CNAME != nil {
+		errs = append(errs, c.CNAME.validate(field.NewPath("cname"))...)
+	}
+	if c.Propagation != nil {
+		errs = append(errs, c.Propagation.validate(field.NewPath("propagation"))...)
+	}
+	return errs.ToAggregate()
+}
+
+func (c PropagationConfig) validate(path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	if c.Timeout != nil {
+		switch {
+		case c.Timeout.Duration <= 0:
+			errs = append(errs, field.Invalid(
+				path.Child("timeout"),
+				c.Timeout.Duration.String(),
+				"must be positive",
+			))
+		case c.Timeout.Duration >= challengeTimeout:
+			errs = append(errs, field.Invalid(
+				path.Child("timeout"),
+				c.Timeout.Duration.String(),
+				fmt.Sprintf("must be less than the challenge timeout of %s", challengeTimeout),
+			))
+		}
+	}
+	if c.PollInterval != nil && c.PollInterval.Duration <= 0 {
+		errs = append(errs, field.Invalid(
+			path.Child("pollInterval"),
+			c.PollInterval.Duration.String(),
+			"must be positive",
+		))
+	}
+	for i, ns := range c.Resolvers {
+		if err := validateNameserver(ns); err != nil {
+			errs = append(errs, field.Invalid(path.Child("resolvers").Index(i), ns, err.Error()))
+		}
+	}
+	for i, ns := range c.Nameservers {
+		if err := validateNameserver(ns); err != nil {
+			errs = append(errs, field.Invalid(path.Child("nameservers").Index(i), ns, err.Error()))
+		}
+	}
+	return errs
+}
+
+func (c CNAMEConfig) validate(path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	switch c.Resolver {
+	case "", CNAMEResolverDNS:
+	case CNAMEResolverAPI:
+		if len(c.Nameservers) > 0 {
+			errs = append(errs, field.Forbidden(
+				path.Child("nameservers"),
+				fmt.Sprintf("may only be set when resolver is %q", CNAMEResolverDNS),
+			))
+		}
+	default:
+		errs = append(errs, field.NotSupported(
+			path.Child("resolver"),
+			c.Resolver,
+			[]CNAMEResolver{CNAMEResolverDNS, CNAMEResolverAPI},
+		))
+	}
+	if c.MaxDepth < 0 {
+		errs = append(errs, field.Invalid(
+			path.Child("maxDepth"),
+			c.MaxDepth,
+			"must not be negative",
+		))
+	}
+	for i, ns := range c.Nameservers {
+		if err := validateNameserver(ns); err != nil {
+			errs = append(errs, field.Invalid(
+				path.Child("nameservers").Index(i),
+				ns,
+				err.Error(),
+			))
+		}
+	}
+	return errs
+}
+
+// validateNameserver validates that the given nameserver is a host or
+// host:port.
+func validateNameserver(ns string) error {
+	host := ns
+	if h, port, err := net.SplitHostPort(ns); err == nil {
+		if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+			return fmt.Errorf("invalid port %q", port)
+		}
+		host = h
+	}
+	if net.ParseIP(host) != nil {
+		return nil
+	}
+	if msgs := validation.IsDNS1123Subdomain(strings.ToLower(host)); len(msgs) > 0 {
+		return errors.New(strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+// errNoCredentials is returned by Config.forZone when no credentials are
+// configured for a zone.
+var errNoCredentials = errors.New("no credentials configured")
+
+// forZone returns a copy of the configuration in which CredentialSource is
+// the source of the credential for the given zone, selected by the first
+// matching entry in Zones or, failing that, the default. It returns an error
+// if no credential is configured for the zone.
+func (c Config) forZone(zone string) (Config, error) {
+	for _, zc := range c.Zones {
+		if zc.matches(zone) {
+			c.CredentialSource = zc.CredentialSource
+			c.Zones = nil
+			return c, nil
+		}
+	}
+	if !c.CredentialSource.isSet() {
+		return c, fmt.Errorf(
+			"%w for zone %q; it matches none of the configured zones and no "+
+				"default is set",
+			errNoCredentials, zone,
+		)
+	}
+	c.Zones = nil
+	return c, nil
+}
+
+// Default sets any optional field that was left unset to its default value.
+func (c *CredentialSource) Default() {
+	if c.CredentialType == "" {
+		c.CredentialType = CredentialTypePAT
+	}
+}
+
+// isSet returns true if any source of the credential is set.
+func (c CredentialSource) isSet() bool {
+	return c.APIKeySecretRef != nil || c.APIKeyFile != "" || c.APIKeyEnv != ""
+}
+
+// sourceName returns the name of the field by which the credential's source is
+// set, or an empty string if none is.
+func (c CredentialSource) sourceName() string {
+	switch {
+	case c.APIKeySecretRef != nil:
+		return "apiKeySecretRef"
+	case c.APIKeyFile != "":
+		return "apiKeyFile"
+	case c.APIKeyEnv != "":
+		return "apiKeyEnv"
+	}
+	return ""
+}
+
+// validate validates that no more than one source of the credential is
+// configured, or exactly one if required is true, and that it is well-formed.
+// Fields are reported relative to the given path, which may be nil.
+func (c CredentialSource) validate(path *field.Path, required bool) field.ErrorList {
+	errs := field.ErrorList{}
+	sources := []string{}
+	if ref := c.APIKeySecretRef; ref != nil {
+		sources = append(sources, "apiKeySecretRef")
+		refPath := path.Child("apiKeySecretRef")
+		if ref.Name == "" {
+			errs = append(errs, field.Required(refPath.Child("name"), ""))
+		}
+		if ref.Key == "" {
+			errs = append(errs, field.Required(refPath.Child("key"), ""))
+		}
+		if ref.Namespace != "" {
+			for _, msg := range validation.IsDNS1123Label(ref.Namespace) {
+				errs = append(errs, field.Invalid(refPath.Child("namespace"), ref.Namespace, msg))
+			}
+		}
+	}
+	if c.APIKeyFile != "" {
+		sources = append(sources, "apiKeyFile")
+		if !filepath.IsAbs(c.APIKeyFile) {
+			errs = append(errs, field.Invalid(
+				path.Child("apiKeyFile"),
+				c.APIKeyFile,
+				"must be an absolute path",
+			))
+		}
+	}
+	if c.APIKeyEnv != "" {
+		sources = append(sources, "apiKeyEnv")
+		for _, msg := range validation.IsEnvVarName(c.APIKeyEnv) {
+			errs = append(errs, field.Invalid(path.Child("apiKeyEnv"), c.APIKeyEnv, msg))
+		}
+	}
+	switch len(sources) {
+	case 0:
+		if required {
+			errs = append(errs, field.Required(
+				path.Child("apiKeySecretRef"),
+				"exactly one of apiKeySecretRef, apiKeyFile, or apiKeyEnv must be set",
+			))
+		}
+	case 1:
+	default:
+		for _, source := range sources[1:] {
+			errs = append(errs, field.Forbidden(
+				path.Child(source),
+				fmt.Sprintf("may not be set together with %s", sources[0]),
+			))
+		}
+	}
+	switch c.CredentialType {
+	case "", CredentialTypePAT, CredentialTypeAPIKey:
+	default:
+		errs = append(errs, field.NotSupported(
+			path.Child("credentialType"),
+			c.CredentialType,
+			[]CredentialType{CredentialTypePAT, CredentialTypeAPIKey},
+		))
+	}
+	return errs
+}
+
+// validate validates that the zone selector is well-formed and that exactly
+// one source of the credential is configured for it.
+func (z ZoneCredentials) validate(path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	switch {
+	case z.Zone == "" && z.ZoneSuffix == "":
+		errs = append(errs, field.Required(
+			path.Child("zone"),
+			"exactly one of zone or zoneSuffix must be set",
+		))
+	case z.Zone != "" && z.ZoneSuffix != "":
+		errs = append(errs, field.Forbidden(
+			path.Child("zoneSuffix"),
+			"may not be set together with zone",
+		))
+	case z.Zone != "":
+		for _, msg := range validation.IsDNS1123Subdomain(normalizeZone(z.Zone)) {
+			errs = append(errs, field.Invalid(path.Child("zone"), z.Zone, msg))
+		}
+	default:
+		for _, msg := range validation.IsDNS1123Subdomain(normalizeZone(z.ZoneSuffix)) {
+			errs = append(errs, field.Invalid(path.Child("zoneSuffix"), z.ZoneSuffix, msg))
+		}
+	}
+	return append(errs, z.CredentialSource.validate(path, true)...)
+}
+
+// matches returns true if the given zone is selected.
+func (z ZoneCredentials) matches(zone string) bool {
+	zone = normalizeZone(zone)
+	if z.Zone != "" {
+		return zone == normalizeZone(z.Zone)
+	}
+	suffix := normalizeZone(z.ZoneSuffix)
+	return zone == suffix || strings.HasSuffix(zone, "."+suffix)
+}
+
+// normalizeZone returns the given zone name in lowercase and without any
+// trailing dot so that equivalent names compare equal.
+func normalizeZone(zone string) string {
+	return strings.ToLower(strings.TrimSuffix(zone, "."))
+}
+
+func validateAPIEndpoint(endpoint string, allowInsecure bool) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+	if !u.IsAbs() || u.Host == "" {
+		return errors.New("not an absolute URL")
+	}
+	switch u.Scheme {
+	case "https":
+	case "http":
+		if !allowInsecure {
+			return errors.New(
+				"does not use https; set allowInsecureAPIEndpoint to permit this",
+			)
+		}
+	default:
+		return fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if u.User != nil {
+		return errors.New("must not contain user info")
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return errors.New("must not contain a query or fragment")
+	}
+	return nil
+}
+
+// retryPolicy returns the retryPolicy described by the configuration.
+func (c Config) retryPolicy() retryPolicy {
+	policy := defaultRetryPolicy
+	if c.Retry == nil {
+		return policy
+	}
+	if c.Retry.MaxAttempts > 0 {
+		policy.maxAttempts = c.Retry.MaxAttempts
+	}
+	if c.Retry.MaxElapsedTime != nil {
+		policy.maxElapsed = c.Retry.MaxElapsedTime.Duration
+	}
+	return policy
+}
+
+// rateLimits returns the rateLimits described by the configuration.
+func (c Config) rateLimits() rateLimits {
+	limits := defaultRateLimits
+	if c.RateLimit == nil {
+		return limits
+	}
+	if c.RateLimit.RequestsPerSecond > 0 {
+		limits.requestsPerSecond = c.RateLimit.RequestsPerSecond
+	}
+	if c.RateLimit.Burst > 0 {
+		limits.burst = c.RateLimit.Burst
+	}
+	return limits
+}
@@ -0,0 +1,605 @@
+package gandi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/stretchr/testify/require"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+func TestLoadConfig(t *testing.T) {
+	testCases := []struct {
+		name       string
+		config     *apiextensionsv1.JSON
+		assertions func(*testing.T, Config, error)
+	}{
+		{
+			name: "no config",
+			assertions: func(t *testing.T, _ Config, err error) {
+				require.ErrorContains(t, err, "no solver config found")
+			},
+		},
+		{
+			name:   "malformed config",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{`)},
+			assertions: func(t *testing.T, _ Config, err error) {
+				require.ErrorContains(t, err, "error decoding solver config")
+			},
+		},
+		{
+			name: "unknown field",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeySecretRef": {"name": "gandi", "key": "token"},
+				"tll": 600
+			}`)},
+			assertions: func(t *testing.T, _ Config, err error) {
+				require.ErrorContains(t, err, "error decoding solver config")
+				require.ErrorContains(t, err, `unknown field "tll"`)
+			},
+		},
+		{
+			name: "miscapitalized field",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeySecretRef": {"name": "gandi", "key": "token"},
+				"TTL": 600
+			}`)},
+			assertions: func(t *testing.T, _ Config, err error) {
+				require.ErrorContains(t, err, `unknown field "TTL"`)
+			},
+		},
+		{
+			name: "duplicate field",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeySecretRef": {"name": "gandi", "key": "token"},
+				"ttl": 600,
+				"ttl": 900
+			}`)},
+			assertions: func(t *testing.T, _ Config, err error) {
+				require.ErrorContains(t, err, `duplicate field "ttl"`)
+			},
+		},
+		{
+			name:   "no credential source",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{}`)},
+			assertions: func(t *testing.T, _ Config, err error) {
+				require.ErrorContains(t, err, "exactly one of apiKeySecretRef, apiKeyFile, or apiKeyEnv")
+			},
+		},
+		{
+			name:   "incomplete secret reference",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{"apiKeySecretRef": {}}`)},
+			assertions: func(t *testing.T, _ Config, err error) {
+				require.ErrorContains(t, err, "apiKeySecretRef.name: Required value")
+				require.ErrorContains(t, err, "apiKeySecretRef.key: Required value")
+			},
+		},
+		{
+			name: "credential file",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeyFile": "/var/run/secrets/gandi/token"
+			}`)},
+			assertions: func(t *testing.T, cfg Config, err error) {
+				require.NoError(t, err)
+				require.Nil(t, cfg.APIKeySecretRef)
+				require.Equal(t, "/var/run/secrets/gandi/token", cfg.APIKeyFile)
+			},
+		},
+		{
+			name: "relative credential file",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeyFile": "gandi/token"
+			}`)},
+			assertions: func(t *testing.T, _ Config, err error) {
+				require.ErrorContains(t, err, "apiKeyFile: Invalid value")
+			},
+		},
+		{
+			name: "credential environment variable",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeyEnv": "GANDI_PAT"
+			}`)},
+			assertions: func(t *testing.T, cfg Config, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "GANDI_PAT", cfg.APIKeyEnv)
+			},
+		},
+		{
+			name: "invalid credential environment variable",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeyEnv": "GANDI=PAT"
+			}`)},
+			assertions: func(t *testing.T, _ Config, err error) {
+				require.ErrorContains(t, err, "apiKeyEnv: Invalid value")
+			},
+		},
+		{
+			name: "multiple credential sources",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeySecretRef": {"name": "gandi", "key": "token"},
+				"apiKeyFile": "/var/run/secrets/gandi/token",
+				"apiKeyEnv": "GANDI_PAT"
+			}`)},
+			assertions: func(t *testing.T, _ Config, err error) {
+				require.ErrorContains(t, err, "apiKeyFile: Forbidden: may not be set together with apiKeySecretRef")
+				require.ErrorContains(t, err, "apiKeyEnv: Forbidden: may not be set together with apiKeySecretRef")
+			},
+		},
+		{
+			name: "multiple problems",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeySecretRef": {"name": "gandi"},
+				"apiEndpoint": "http://proxy.example.com",
+				"ttl": 60,
+				"retry": {"maxAttempts": -1, "maxElapsedTime": "0s"}
+			}`)},
+			assertions: func(t *testing.T, _ Config, err error) {
+				// All problems should be reported at once
+				require.ErrorContains(t, err, "apiKeySecretRef.key: Required value")
+				require.ErrorContains(t, err, "apiEndpoint: Invalid value")
+				require.ErrorContains(t, err, "ttl: Invalid value")
+				require.ErrorContains(t, err, "retry.maxAttempts: Invalid value")
+				require.ErrorContains(t, err, "retry.maxElapsedTime: Invalid value")
+			},
+		},
+		{
+			name: "minimal config",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeySecretRef": {"name": "gandi", "key": "token"}
+			}`)},
+			assertions: func(t *testing.T, cfg Config, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "gandi", cfg.APIKeySecretRef.Name)
+				require.Equal(t, "token", cfg.APIKeySecretRef.Key)
+				require.Empty(t, cfg.APIKeySecretRef.Namespace)
+				require.Equal(t, CredentialTypePAT, cfg.CredentialType)
+				require.Equal(t, defaultAPIEndpoint, cfg.APIEndpoint)
+				require.False(t, cfg.AllowInsecureAPIEndpoint)
+				require.Equal(t, minTTL, cfg.TTL)
+				require.Equal(t, defaultRetryPolicy.maxAttempts, cfg.Retry.MaxAttempts)
+				require.Equal(t, defaultRetryPolicy.maxElapsed, cfg.Retry.MaxElapsedTime.Duration)
+				require.Equal(t, defaultRetryPolicy, cfg.retryPolicy())
+				require.Equal(t, defaultRateLimits, cfg.rateLimits())
+			},
+		},
+		{
+			name: "secret in another namespace",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeySecretRef": {
+					"name": "gandi",
+					"key": "token",
+					"namespace": "dns-credentials"
+				}
+			}`)},
+			assertions: func(t *testing.T, cfg Config, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "gandi", cfg.APIKeySecretRef.Name)
+				require.Equal(t, "token", cfg.APIKeySecretRef.Key)
+				require.Equal(t, "dns-credentials", cfg.APIKeySecretRef.Namespace)
+			},
+		},
+		{
+			name: "invalid secret namespace",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeySecretRef": {
+					"name": "gandi",
+					"key": "token",
+					"namespace": "DNS_Credentials"
+				}
+			}`)},
+			assertions: func(t *testing.T, _ Config, err error) {
+				require.ErrorContains(t, err, "apiKeySecretRef.namespace")
+			},
+		},
+		{
+			name: "zone credentials",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"zones": [
+					{
+						"zone": "example.com",
+						"apiKeySecretRef": {"name": "gandi-a", "key": "token"}
+					},
+					{
+						"zoneSuffix": "example.org",
+						"apiKeySecretRef": {"name": "gandi-b", "key": "token"},
+						"credentialType": "apikey"
+					}
+				]
+			}`)},
+			assertions: func(t *testing.T, cfg Config, err error) {
+				require.NoError(t, err)
+				require.Nil(t, cfg.APIKeySecretRef)
+				require.Len(t, cfg.Zones, 2)
+				require.Equal(t, CredentialTypePAT, cfg.Zones[0].CredentialType)
+				require.Equal(t, CredentialTypeAPIKey, cfg.Zones[1].CredentialType)
+			},
+		},
+		{
+			name: "invalid zone credentials",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeySecretRef": {"name": "gandi", "key": "token"},
+				"zones": [
+					{"apiKeySecretRef": {"name": "gandi-a", "key": "token"}},
+					{
+						"zone": "example.com",
+						"zoneSuffix": "example.com",
+						"apiKeySecretRef": {"name": "gandi-b", "key": "token"}
+					},
+					{"zone": "example_com", "apiKeyEnv": "GANDI_PAT"},
+					{"zoneSuffix": "example.org"}
+				]
+			}`)},
+			assertions: func(t *testing.T, _ Config, err error) {
+				require.ErrorContains(t, err, "zones[0].zone: Required value")
+				require.ErrorContains(t, err, "zones[1].zoneSuffix: Forbidden")
+				require.ErrorContains(t, err, "zones[2].zone: Invalid value")
+				require.ErrorContains(t, err, "zones[3].apiKeySecretRef: Required value")
+			},
+		},
+		{
+			name: "CNAME following",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeySecretRef": {"name": "gandi", "key": "token"},
+				"cname": {}
+			}`)},
+			assertions: func(t *testing.T, cfg Config, err error) {
+				require.NoError(t, err)
+				require.Equal(t, CNAMEResolverDNS, cfg.CNAME.Resolver)
+				require.Equal(t, defaultMaxCNAMEDepth, cfg.CNAME.MaxDepth)
+				require.Empty(t, cfg.CNAME.Nameservers)
+			},
+		},
+		{
+			name: "CNAME following with nameservers",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeySecretRef": {"name": "gandi", "key": "token"},
+				"cname": {
+					"maxDepth": 2,
+					"nameservers": ["1.1.1.1", "[2606:4700:4700::1111]:53", "dns.example.com:5353"]
+				}
+			}`)},
+			assertions: func(t *testing.T, cfg Config, err error) {
+				require.NoError(t, err)
+				require.Equal(t, 2, cfg.CNAME.MaxDepth)
+				require.Len(t, cfg.CNAME.Nameservers, 3)
+			},
+		},
+		{
+			name: "invalid CNAME following",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeySecretRef": {"name": "gandi", "key": "token"},
+				"cname": {
+					"resolver": "carrier-pigeon",
+					"maxDepth": -1,
+					"nameservers": ["1.1.1.1:0", "not a host"]
+				}
+			}`)},
+			assertions: func(t *testing.T, _ Config, err error) {
+				require.ErrorContains(t, err, `cname.resolver: Unsupported value: "carrier-pigeon"`)
+				require.ErrorContains(t, err, "cname.maxDepth: Invalid value")
+				require.ErrorContains(t, err, "cname.nameservers[0]: Invalid value")
+				require.ErrorContains(t, err, "cname.nameservers[1]: Invalid value")
+			},
+		},
+		{
+			name: "nameservers with API resolver",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeySecretRef": {"name": "gandi", "key": "token"},
+				"cname": {"resolver": "api", "nameservers": ["1.1.1.1"]}
+			}`)},
+			assertions: func(t *testing.T, _ Config, err error) {
+				require.ErrorContains(t, err, "cname.nameservers: Forbidden")
+			},
+		},
+		{
+			name: "propagation",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeySecretRef": {"name": "gandi", "key": "token"},
+				"propagation": {"nameservers": ["ns-1.example.net"]}
+			}`)},
+			assertions: func(t *testing.T, cfg Config, err error) {
+				require.NoError(t, err)
+				require.Equal(t, defaultPropagationTimeout, cfg.Propagation.Timeout.Duration)
+				require.Equal(t, defaultPropagationPollInterval, cfg.Propagation.PollInterval.Duration)
+				require.Equal(t, []string{"ns-1.example.net"}, cfg.Propagation.Nameservers)
+			},
+		},
+		{
+			name: "invalid propagation",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeySecretRef": {"name": "gandi", "key": "token"},
+				"propagation": {
+					"timeout": "0s",
+					"pollInterval": "-1s",
+					"resolvers": ["1.1.1.1:99999"],
+					"nameservers": ["ns_1.example.net"]
+				}
+			}`)},
+			assertions: func(t *testing.T, _ Config, err error) {
+				require.ErrorContains(t, err, "propagation.timeout: Invalid value")
+				require.ErrorContains(t, err, "propagation.pollInterval: Invalid value")
+				require.ErrorContains(t, err, "propagation.resolvers[0]: Invalid value")
+				require.ErrorContains(t, err, "propagation.nameservers[0]: Invalid value")
+			},
+		},
+		{
+			name: "propagation timeout exceeding challenge timeout",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeySecretRef": {"name": "gandi", "key": "token"},
+				"propagation": {"timeout": "1m"}
+			}`)},
+			assertions: func(t *testing.T, _ Config, err error) {
+				require.ErrorContains(t, err, "propagation.timeout: Invalid value")
+				require.ErrorContains(t, err, "must be less than the challenge timeout")
+			},
+		},
+		{
+			name: "legacy API key",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeySecretRef": {"name": "gandi", "key": "token"},
+				"credentialType": "apikey"
+			}`)},
+			assertions: func(t *testing.T, cfg Config, err error) {
+				require.NoError(t, err)
+				require.Equal(t, CredentialTypeAPIKey, cfg.CredentialType)
+			},
+		},
+		{
+			name: "unknown credential type",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeySecretRef": {"name": "gandi", "key": "token"},
+				"credentialType": "password"
+			}`)},
+			assertions: func(t *testing.T, _ Config, err error) {
+				require.ErrorContains(t, err, `credentialType: Unsupported value: "password"`)
+			},
+		},
+		{
+			name: "custom API endpoint",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeySecretRef": {"name": "gandi", "key": "token"},
+				"apiEndpoint": "https://dns.api.gandi.net/api/v5/"
+			}`)},
+			assertions: func(t *testing.T, cfg Config, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "https://dns.api.gandi.net/api/v5", cfg.APIEndpoint)
+			},
+		},
+		{
+			name: "relative API endpoint",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeySecretRef": {"name": "gandi", "key": "token"},
+				"apiEndpoint": "/v5/livedns"
+			}`)},
+			assertions: func(t *testing.T, _ Config, err error) {
+				require.ErrorContains(t, err, "not an absolute URL")
+			},
+		},
+		{
+			name: "API endpoint with unsupported scheme",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeySecretRef": {"name": "gandi", "key": "token"},
+				"apiEndpoint": "ftp://proxy.example.com"
+			}`)},
+			assertions: func(t *testing.T, _ Config, err error) {
+				require.ErrorContains(t, err, "unsupported scheme")
+			},
+		},
+		{
+			name: "insecure API endpoint",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeySecretRef": {"name": "gandi", "key": "token"},
+				"apiEndpoint": "http://proxy.example.com"
+			}`)},
+			assertions: func(t *testing.T, _ Config, err error) {
+				require.ErrorContains(t, err, "does not use https")
+			},
+		},
+		{
+			name: "explicitly allowed insecure API endpoint",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeySecretRef": {"name": "gandi", "key": "token"},
+				"apiEndpoint": "http://proxy.example.com",
+				"allowInsecureAPIEndpoint": true
+			}`)},
+			assertions: func(t *testing.T, cfg Config, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "http://proxy.example.com", cfg.APIEndpoint)
+			},
+		},
+		{
+			name: "custom TTL",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeySecretRef": {"name": "gandi", "key": "token"},
+				"ttl": 3600
+			}`)},
+			assertions: func(t *testing.T, cfg Config, err error) {
+				require.NoError(t, err)
+				require.Equal(t, 3600, cfg.TTL)
+			},
+		},
+		{
+			name: "TTL too short",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeySecretRef": {"name": "gandi", "key": "token"},
+				"ttl": 60
+			}`)},
+			assertions: func(t *testing.T, _ Config, err error) {
+				require.ErrorContains(t, err, "ttl: Invalid value")
+			},
+		},
+		{
+			name: "TTL too long",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeySecretRef": {"name": "gandi", "key": "token"},
+				"ttl": 604800
+			}`)},
+			assertions: func(t *testing.T, _ Config, err error) {
+				require.ErrorContains(t, err, "ttl: Invalid value")
+			},
+		},
+		{
+			name: "retry overrides",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeySecretRef": {"name": "gandi", "key": "token"},
+				"retry": {"maxAttempts": 2, "maxElapsedTime": "1m"}
+			}`)},
+			assertions: func(t *testing.T, cfg Config, err error) {
+				require.NoError(t, err)
+				policy := cfg.retryPolicy()
+				require.Equal(t, 2, policy.maxAttempts)
+				require.Equal(t, time.Minute, policy.maxElapsed)
+				require.Equal(t, defaultRetryPolicy.initialBackoff, policy.initialBackoff)
+			},
+		},
+		{
+			name: "invalid retry overrides",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeySecretRef": {"name": "gandi", "key": "token"},
+				"retry": {"maxAttempts": -1}
+			}`)},
+			assertions: func(t *testing.T, _ Config, err error) {
+				require.ErrorContains(t, err, "retry.maxAttempts")
+			},
+		},
+		{
+			name: "rate limit overrides",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeySecretRef": {"name": "gandi", "key": "token"},
+				"rateLimit": {"requestsPerSecond": 0.5, "burst": 5}
+			}`)},
+			assertions: func(t *testing.T, cfg Config, err error) {
+				require.NoError(t, err)
+				require.Equal(t, rateLimits{requestsPerSecond: 0.5, burst: 5}, cfg.rateLimits())
+			},
+		},
+		{
+			name: "invalid rate limit overrides",
+			config: &apiextensionsv1.JSON{Raw: []byte(`{
+				"apiKeySecretRef": {"name": "gandi", "key": "token"},
+				"rateLimit": {"requestsPerSecond": -1, "burst": -1}
+			}`)},
+			assertions: func(t *testing.T, _ Config, err error) {
+				require.ErrorContains(t, err, "rateLimit.requestsPerSecond: Invalid value")
+				require.ErrorContains(t, err, "rateLimit.burst: Invalid value")
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			cfg, err := loadConfig(v1alpha1.ChallengeRequest{Config: testCase.config})
+			testCase.assertions(t, cfg, err)
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	cfg := Config{
+		CredentialSource: CredentialSource{
+			APIKeySecretRef: &SecretKeySelector{
+				SecretKeySelector: cmmeta.SecretKeySelector{
+					LocalObjectReference: cmmeta.LocalObjectReference{Name: "gandi"},
+					Key:                  "token",
+				},
+			},
+		},
+	}
+	// Unset optional fields are valid with or without defaults applied
+	require.NoError(t, cfg.Validate())
+	cfg.Default()
+	require.NoError(t, cfg.Validate())
+	// Defaulting is idempotent
+	defaulted := cfg
+	cfg.Default()
+	require.Equal(t, defaulted, cfg)
+}
+
+func TestConfigForZone(t *testing.T) {
+	secretSource := func(name string) CredentialSource {
+		return CredentialSource{
+			APIKeySecretRef: &SecretKeySelector{
+				SecretKeySelector: cmmeta.SecretKeySelector{
+					LocalObjectReference: cmmeta.LocalObjectReference{Name: name},
+					Key:                  "token",
+				},
+			},
+		}
+	}
+	zones := []ZoneCredentials{
+		{Zone: "example.com", CredentialSource: secretSource("exact")},
+		{ZoneSuffix: "example.com", CredentialSource: secretSource("suffix")},
+		{ZoneSuffix: "Example.ORG.", CredentialSource: secretSource("org")},
+	}
+	testCases := []struct {
+		name       string
+		cfg        Config
+		zone       string
+		assertions func(*testing.T, Config, error)
+	}{
+		{
+			name: "exact match",
+			cfg:  Config{Zones: zones},
+			zone: "example.com",
+			assertions: func(t *testing.T, cfg Config, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "exact", cfg.APIKeySecretRef.Name)
+				require.Nil(t, cfg.Zones)
+			},
+		},
+		{
+			name: "suffix match",
+			cfg:  Config{Zones: zones},
+			zone: "sub.example.com",
+			assertions: func(t *testing.T, cfg Config, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "suffix", cfg.APIKeySecretRef.Name)
+			},
+		},
+		{
+			name: "suffix matches the zone itself",
+			cfg:  Config{Zones: zones},
+			zone: "example.org",
+			assertions: func(t *testing.T, cfg Config, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "org", cfg.APIKeySecretRef.Name)
+			},
+		},
+		{
+			name: "suffix only matches whole labels",
+			cfg:  Config{Zones: zones},
+			zone: "notexample.org",
+			assertions: func(t *testing.T, _ Config, err error) {
+				require.ErrorContains(t, err, `no credentials configured for zone "notexample.org"`)
+			},
+		},
+		{
+			name: "default",
+			cfg: Config{
+				CredentialSource: secretSource("default"),
+				Zones:            zones,
+			},
+			zone: "example.net",
+			assertions: func(t *testing.T, cfg Config, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "default", cfg.APIKeySecretRef.Name)
+			},
+		},
+		{
+			name: "no zones",
+			cfg:  Config{CredentialSource: secretSource("default")},
+			zone: "example.com",
+			assertions: func(t *testing.T, cfg Config, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "default", cfg.APIKeySecretRef.Name)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			cfg, err := testCase.cfg.forZone(testCase.zone)
+			testCase.assertions(t, cfg, err)
+		})
+	}
+}
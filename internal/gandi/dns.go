@@ -0,0 +1,152 @@
+package gandi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// resolvConfPath is the resolver configuration consulted for nameservers
+	// when none are configured explicitly.
+	resolvConfPath = "/etc/resolv.conf"
+	// dnsQueryTimeout bounds the time spent on any single DNS query.
+	dnsQueryTimeout = 5 * time.Second
+)
+
+// dnsResolver sends DNS queries to a fixed list of nameservers.
+type dnsResolver struct {
+	nameservers []string
+	// recursive determines whether queries ask for recursion
+	recursive bool
+	udp       *dns.Client
+	tcp       *dns.Client
+}
+
+// newRecursiveDNSResolver returns a dnsResolver that queries the given
+// recursive nameservers or, if there are none, those in /etc/resolv.conf.
+func newRecursiveDNSResolver(nameservers []string) (*dnsResolver, error) {
+	if len(nameservers) == 0 {
+		resolvConf, err := dns.ClientConfigFromFile(resolvConfPath)
+		if err != nil {
+			return nil, fmt.Errorf("error reading nameservers from %s: %w", resolvConfPath, err)
+		}
+		for _, ns := range resolvConf.Servers {
+			nameservers = append(nameservers, net.JoinHostPort(ns, resolvConf.Port))
+		}
+	}
+	return newDNSResolver(nameservers, true), nil
+}
+
+// newDNSResolver returns a dnsResolver that queries the given nameservers,
+// given as host or host:port, asking for recursion only if recursive is true.
+func newDNSResolver(nameservers []string, recursive bool) *dnsResolver {
+	r := &dnsResolver{
+		nameservers: make([]string, len(nameservers)),
+		recursive:   recursive,
+		udp:         &dns.Client{Net: "udp", Timeout: dnsQueryTimeout},
+		tcp:         &dns.Client{Net: "tcp", Timeout: dnsQueryTimeout},
+	}
+	for i, ns := range nameservers {
+		r.nameservers[i] = withDefaultPort(ns, "53")
+	}
+	return r
+}
+
+// query sends the given question to each nameserver in turn until one of them
+// answers it. A response stating that the name does not exist counts as an
+// answer.
+func (r *dnsResolver) query(
+	ctx context.Context,
+	fqdn string,
+	qtype uint16,
+) (*dns.Msg, error) {
+	errs := []error{}
+	for _, ns := range r.nameservers {
+		res, err := r.queryServer(ctx, ns, fqdn, qtype)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		return res, nil
+	}
+	if len(errs) == 0 {
+		return nil, errors.New("no nameservers configured")
+	}
+	return nil, errors.Join(errs...)
+}
+
+// queryServer sends the given question to the given nameserver, retrying over
+// TCP if the response is truncated. A response stating that the name does not
+// exist is not an error.
+func (r *dnsResolver) queryServer(
+	ctx context.Context,
+	ns string,
+	fqdn string,
+	qtype uint16,
+) (*dns.Msg, error) {
+	msg := &dns.Msg{}
+	msg.SetQuestion(fqdn, qtype)
+	msg.RecursionDesired = r.recursive
+	res, _, err := r.udp.ExchangeContext(ctx, msg, ns)
+	if err == nil && res.Truncated {
+		res, _, err = r.tcp.ExchangeContext(ctx, msg, ns)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying %s: %w", ns, err)
+	}
+	if res.Rcode != dns.RcodeSuccess && res.Rcode != dns.RcodeNameError {
+		return nil, fmt.Errorf("%s responded with %s", ns, dns.RcodeToString[res.Rcode])
+	}
+	return res, nil
+}
+
+// findZone returns the name, without a trailing dot, of the zone hosting the
+// given fully qualified name.
+func (r *dnsResolver) findZone(ctx context.Context, fqdn string) (string, error) {
+	res, err := r.query(ctx, fqdn, dns.TypeSOA)
+	if err != nil {
+		return "", err
+	}
+	// The zone's SOA record is in the answer if the name is the zone's apex and
+	// in the authority section otherwise.
+	for _, rr := range append(res.Answer, res.Ns...) {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return normalizeZone(soa.Hdr.Name), nil
+		}
+	}
+	return "", fmt.Errorf("no SOA record found for %q", fqdn)
+}
+
+// lookupNS returns the names of the authoritative nameservers of the given
+// zone.
+func (r *dnsResolver) lookupNS(ctx context.Context, zone string) ([]string, error) {
+	res, err := r.query(ctx, normalizeFQDN(zone), dns.TypeNS)
+	if err != nil {
+		return nil, err
+	}
+	nameservers := []string{}
+	for _, rr := range res.Answer {
+		if ns, ok := rr.(*dns.NS); ok {
+			nameservers = append(nameservers, strings.TrimSuffix(ns.Ns, "."))
+		}
+	}
+	if len(nameservers) == 0 {
+		return nil, fmt.Errorf("no NS records found for zone %q", zone)
+	}
+	return nameservers, nil
+}
+
+// withDefaultPort returns the given host or host:port with the given port
+// added if it has none.
+func withDefaultPort(hostport, port string) string {
+	if _, _, err := net.SplitHostPort(hostport); err == nil {
+		return hostport
+	}
+	return net.JoinHostPort(hostport, port)
+}
@@ -0,0 +1,39 @@
+package gandi
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSResolverLookupNS(t *testing.T) {
+	f := newFakeDNS(t)
+	f.add(
+		t,
+		testSOA(testZone),
+		testZone+". 300 IN NS ns-1.example.net.",
+		testZone+". 300 IN NS ns-2.example.net.",
+	)
+	r := newDNSResolver([]string{f.addr}, true)
+	ctx := context.Background()
+
+	nameservers, err := r.lookupNS(ctx, testZone)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"ns-1.example.net", "ns-2.example.net"}, nameservers)
+
+	_, err = r.lookupNS(ctx, "example.org")
+	require.ErrorContains(t, err, `no NS records found for zone "example.org"`)
+}
+
+func TestDNSResolverNoNameservers(t *testing.T) {
+	_, err := newDNSResolver(nil, true).query(context.Background(), testFQDN, 0)
+	require.ErrorContains(t, err, "no nameservers configured")
+}
+
+func TestWithDefaultPort(t *testing.T) {
+	require.Equal(t, "1.1.1.1:53", withDefaultPort("1.1.1.1", "53"))
+	require.Equal(t, "1.1.1.1:5353", withDefaultPort("1.1.1.1:5353", "53"))
+	require.Equal(t, "[2606:4700:4700::1111]:53", withDefaultPort("2606:4700:4700::1111", "53"))
+	require.Equal(t, "ns-1.example.net:53", withDefaultPort("ns-1.example.net", "53"))
+}
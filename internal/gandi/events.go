@@ -0,0 +1,224 @@
+package gandi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	cmacme "github.com/cert-manager/cert-manager/pkg/apis/acme/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
+
+	"github.com/krancovia/cert-manager-webhook-gandi/pkg/livedns"
+)
+
+const (
+	// eventSourceComponent is the component to which recorded Events are
+	// attributed.
+	eventSourceComponent = "cert-manager-webhook-gandi"
+	// eventBurst and eventQPS bound the rate at which Events are recorded for
+	// any single Challenge. Events in excess of this are dropped by the
+	// broadcaster.
+	eventBurst = 10
+	eventQPS   = 1. / 60.
+	// eventGlobalBurst and eventGlobalQPS bound the rate at which Events are
+	// recorded across all Challenges. Events in excess of this are dropped.
+	eventGlobalBurst = 25
+	eventGlobalQPS   = 1
+)
+
+// Reasons for Events recorded by the solver.
+const (
+	reasonRecordCreated        = "RecordCreated"
+	reasonRecordUpdated        = "RecordUpdated"
+	reasonRecordDeleted        = "RecordDeleted"
+	reasonAuthenticationFailed = "AuthenticationFailed"
+	reasonAPIError             = "APIError"
+	reasonPresentFailed        = "PresentFailed"
+	reasonCleanUpFailed        = "CleanUpFailed"
+)
+
+// recordSetChange describes the change, if any, made to a TXT record set while
+// presenting or cleaning up a challenge.
+type recordSetChange int
+
+const (
+	recordUnchanged recordSetChange = iota
+	recordCreated
+	recordUpdated
+	recordDeleted
+)
+
+// challengeEvents records Kubernetes Events pertaining to the Challenges
+// solved by the solver so that they are visible to anyone describing a
+// Challenge.
+type challengeEvents struct {
+	recorder   record.EventRecorder
+	challenges *challengeCache
+	// limiter bounds the rate at which Events are recorded across all
+	// Challenges. The broadcaster only bounds the rate per Challenge.
+	limiter flowcontrol.RateLimiter
+	// isClusterScoped returns true if a challenge with the given resource
+	// namespace was issued by a ClusterIssuer.
+	isClusterScoped func(resourceNamespace string) bool
+}
+
+// newChallengeEvents returns a challengeEvents that records Events using a new
+// broadcaster writing to the API server through the given client and finds
+// the Challenges they pertain to in the given cache. The broadcaster is shut
+// down when the given context is canceled.
+func newChallengeEvents(
+	ctx context.Context,
+	client kubernetes.Interface,
+	challenges *challengeCache,
+	isClusterScoped func(resourceNamespace string) bool,
+) *challengeEvents {
+	broadcaster := record.NewBroadcaster(
+		record.WithContext(ctx),
+		record.WithCorrelatorOptions(record.CorrelatorOptions{
+			BurstSize: eventBurst,
+			QPS:       eventQPS,
+		}),
+	)
+	broadcaster.StartRecordingToSink(
+		&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events(metav1.NamespaceAll)},
+	)
+	return &challengeEvents{
+		recorder: broadcaster.NewRecorder(
+			scheme.Scheme,
+			corev1.EventSource{Component: eventSourceComponent},
+		),
+		challenges:      challenges,
+		limiter:         flowcontrol.NewTokenBucketRateLimiter(eventGlobalQPS, eventGlobalBurst),
+		isClusterScoped: isClusterScoped,
+	}
+}
+
+// recordChange records a Normal Event for the given change to the TXT record
+// set with the given name in the given zone. Nothing is recorded if nothing
+// was changed.
+func (e *challengeEvents) recordChange(
+	ctx context.Context,
+	cr v1alpha1.ChallengeRequest,
+	change recordSetChange,
+	zone string,
+	entry string,
+) {
+	var reason, verb string
+	switch change {
+	case recordCreated:
+		reason, verb = reasonRecordCreated, "Created"
+	case recordUpdated:
+		reason, verb = reasonRecordUpdated, "Updated"
+	case recordDeleted:
+		reason, verb = reasonRecordDeleted, "Deleted"
+	default:
+		return
+	}
+	e.record(
+		ctx, cr, corev1.EventTypeNormal, reason,
+		fmt.Sprintf("%s TXT record %q in domain %q", verb, entry, zone),
+	)
+}
+
+// recordFailure records a Warning Event for the given error. Errors from the
+// LiveDNS API are distinguished from other failures, for which the given
+// reason is used.
+func (e *challengeEvents) recordFailure(
+	ctx context.Context,
+	cr v1alpha1.ChallengeRequest,
+	reason string,
+	err error,
+) {
+	var apiErr *livedns.APIError
+	switch {
+	case livedns.IsUnauthorized(err) || livedns.IsForbidden(err):
+		reason = reasonAuthenticationFailed
+	case errors.As(err, &apiErr):
+		reason = reasonAPIError
+	}
+	e.record(ctx, cr, corev1.EventTypeWarning, reason, err.Error())
+}
+
+// record records an Event with the given type, reason, and message for the
+// Challenge corresponding to the given ChallengeRequest. The Event is dropped
+// if the global rate limit has been exceeded or the Challenge can't be found.
+// It is also dropped if Challenges have not yet been cached, as is the case
+// shortly after the webhook starts, so that recording an Event never holds up
+// a challenge. Nothing is recorded by a nil challengeEvents, as is used before
+// Initialize has been called.
+func (e *challengeEvents) record(
+	ctx context.Context,
+	cr v1alpha1.ChallengeRequest,
+	eventType string,
+	reason string,
+	message string,
+) {
+	if e == nil || !e.limiter.TryAccept() {
+		return
+	}
+	log := challengeLogFrom(ctx)
+	if !e.challenges.hasSynced() {
+		log.logger().Debug(
+			"not recording event; Challenges are not yet cached",
+			"reason", reason,
+			"durationMs", log.elapsedMs(),
+		)
+		return
+	}
+	ref, err := e.findChallenge(ctx, cr)
+	if err != nil {
+		log.logger().Warn(
+			"not recording event",
+			"reason", reason,
+			"durationMs", log.elapsedMs(),
+			"error", err,
+		)
+		return
+	}
+	e.recorder.Event(ref, eventType, reason, message)
+}
+
+// findChallenge returns a reference to the Challenge corresponding to the
+// given ChallengeRequest. A Challenge is matched by UID if the request carries
+// one and otherwise by its DNS name and key, which together are unique to a
+// Challenge. Challenges for Issuers share the request's resource namespace.
+// Challenges for ClusterIssuers may be in any namespace.
+func (e *challengeEvents) findChallenge(
+	ctx context.Context,
+	cr v1alpha1.ChallengeRequest,
+) (*corev1.ObjectReference, error) {
+	var candidates []*cmacme.Challenge
+	if cr.UID != "" {
+		var err error
+		if candidates, err = e.challenges.byUID(ctx, cr.UID); err != nil {
+			return nil, err
+		}
+	}
+	if len(candidates) == 0 {
+		var err error
+		if candidates, err = e.challenges.byDNS01(ctx, cr.DNSName, cr.Key); err != nil {
+			return nil, err
+		}
+	}
+	clusterScoped := e.isClusterScoped(cr.ResourceNamespace)
+	for _, ch := range candidates {
+		if clusterScoped || ch.Namespace == cr.ResourceNamespace {
+			return &corev1.ObjectReference{
+				APIVersion:      cmacme.SchemeGroupVersion.String(),
+				Kind:            cmacme.ChallengeKind,
+				Namespace:       ch.Namespace,
+				Name:            ch.Name,
+				UID:             ch.UID,
+				ResourceVersion: ch.ResourceVersion,
+			}, nil
+		}
+	}
+	return nil, errors.New("no matching Challenge found")
+}
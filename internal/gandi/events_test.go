@@ -0,0 +1,238 @@
+package gandi
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	cmacme "github.com/cert-manager/cert-manager/pkg/apis/acme/v1"
+	cmfake "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+func newTestChallenge(namespace, name, key string) *cmacme.Challenge {
+	return &cmacme.Challenge{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+			UID:       types.UID(namespace + "/" + name),
+		},
+		Spec: cmacme.ChallengeSpec{
+			Type:    cmacme.ACMEChallengeTypeDNS01,
+			DNSName: testZone,
+			Key:     key,
+		},
+	}
+}
+
+// newTestChallengeEvents returns a challengeEvents that records Events to a
+// fake recorder and finds the given Challenges.
+func newTestChallengeEvents(
+	t *testing.T,
+	s *solver,
+	challenges ...*cmacme.Challenge,
+) (*challengeEvents, *record.FakeRecorder) {
+	objects := make([]runtime.Object, len(challenges))
+	for i, ch := range challenges {
+		objects[i] = ch
+	}
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	cache := newChallengeCache(cmfake.NewSimpleClientset(objects...), stopCh)
+	// Events are dropped until Challenges have been cached
+	require.NoError(t, cache.waitForSync(context.Background()))
+	recorder := record.NewFakeRecorder(100)
+	return &challengeEvents{
+		recorder:        recorder,
+		challenges:      cache,
+		limiter:         flowcontrol.NewFakeAlwaysRateLimiter(),
+		isClusterScoped: s.isClusterScoped,
+	}, recorder
+}
+
+// recordedEvents drains and returns the Events recorded by the given fake
+// recorder.
+func recordedEvents(recorder *record.FakeRecorder) []string {
+	var events []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestChallengeEventsFindChallenge(t *testing.T) {
+	testCases := []struct {
+		name              string
+		resourceNamespace string
+		uid               types.UID
+		key               string
+		assertions        func(*testing.T, string, error)
+	}{
+		{
+			name:              "Issuer matched by DNS name and key",
+			resourceNamespace: "team-a",
+			key:               "key-a",
+			assertions: func(t *testing.T, name string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "team-a/challenge-a", name)
+			},
+		},
+		{
+			name:              "Issuer matched by UID",
+			resourceNamespace: "team-a",
+			uid:               "team-a/challenge-a",
+			key:               "rotated",
+			assertions: func(t *testing.T, name string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "team-a/challenge-a", name)
+			},
+		},
+		{
+			name:              "Issuer cannot match Challenges in other namespaces",
+			resourceNamespace: "team-a",
+			key:               "key-b",
+			assertions: func(t *testing.T, _ string, err error) {
+				require.ErrorContains(t, err, "no matching Challenge found")
+			},
+		},
+		{
+			name:              "ClusterIssuer matches Challenges in any namespace",
+			resourceNamespace: testNamespace,
+			key:               "key-b",
+			assertions: func(t *testing.T, name string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "team-b/challenge-b", name)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			e, _ := newTestChallengeEvents(
+				t,
+				newTestSolver(t),
+				newTestChallenge("team-a", "challenge-a", "key-a"),
+				newTestChallenge("team-b", "challenge-b", "key-b"),
+			)
+			ref, err := e.findChallenge(context.Background(), v1alpha1.ChallengeRequest{
+				UID:               testCase.uid,
+				ResourceNamespace: testCase.resourceNamespace,
+				DNSName:           testZone,
+				Key:               testCase.key,
+			})
+			var name string
+			if ref != nil {
+				require.Equal(t, cmacme.ChallengeKind, ref.Kind)
+				require.Equal(t, "acme.cert-manager.io/v1", ref.APIVersion)
+				name = ref.Namespace + "/" + ref.Name
+			}
+			testCase.assertions(t, name, err)
+		})
+	}
+}
+
+func TestChallengeEventsRateLimited(t *testing.T) {
+	e, recorder := newTestChallengeEvents(
+		t,
+		newTestSolver(t),
+		newTestChallenge(testNamespace, "challenge", "key1"),
+	)
+	e.limiter = flowcontrol.NewTokenBucketRateLimiter(0.001, 2)
+	cr := v1alpha1.ChallengeRequest{
+		ResourceNamespace: testNamespace,
+		DNSName:           testZone,
+		Key:               "key1",
+	}
+	for range 5 {
+		e.recordChange(context.Background(), cr, recordCreated, testZone, testEntryName)
+	}
+	require.Len(t, recordedEvents(recorder), 2)
+}
+
+func TestSolverRecordsEvents(t *testing.T) {
+	f := newFakeLiveDNS(t)
+	s := newTestSolver(t)
+	var recorder *record.FakeRecorder
+	s.events, recorder = newTestChallengeEvents(
+		t,
+		s,
+		newTestChallenge(testNamespace, "challenge-1", "key1"),
+		newTestChallenge(testNamespace, "challenge-2", "key2"),
+	)
+
+	runChallengeSteps(t, s, f, []challengeStep{
+		present("key1"),
+		present("key1"),
+		present("key2"),
+		cleanUp("key1"),
+		cleanUp("key2"),
+	})
+	require.Equal(
+		t,
+		[]string{
+			`Normal RecordCreated Created TXT record "_acme-challenge" in domain "example.com"`,
+			`Normal RecordUpdated Updated TXT record "_acme-challenge" in domain "example.com"`,
+			`Normal RecordUpdated Updated TXT record "_acme-challenge" in domain "example.com"`,
+			`Normal RecordDeleted Deleted TXT record "_acme-challenge" in domain "example.com"`,
+		},
+		recordedEvents(recorder),
+	)
+
+	f.failWith(http.MethodPost, http.StatusForbidden)
+	require.Error(t, s.Present(newTestChallengeRequest(t, f, "key1")))
+	events := recordedEvents(recorder)
+	require.Len(t, events, 1)
+	require.Contains(t, events[0], "Warning AuthenticationFailed")
+
+	f.failWith(http.MethodPost, http.StatusBadRequest)
+	require.Error(t, s.Present(newTestChallengeRequest(t, f, "key1")))
+	events = recordedEvents(recorder)
+	require.Len(t, events, 1)
+	require.Contains(t, events[0], "Warning APIError")
+
+	cr := newTestChallengeRequest(t, f, "key1")
+	cr.Config = nil
+	require.Error(t, s.Present(cr))
+	events = recordedEvents(recorder)
+	require.Len(t, events, 1)
+	require.Contains(t, events[0], "Warning PresentFailed no solver config found")
+
+	// Events for Challenges that can't be found are dropped
+	require.Error(t, s.Present(newTestChallengeRequest(t, f, "key3")))
+	require.Empty(t, recordedEvents(recorder))
+}
+
+func TestChallengeEventsNotSynced(t *testing.T) {
+	// An informer that is never started never syncs
+	stopCh := make(chan struct{})
+	close(stopCh)
+	recorder := record.NewFakeRecorder(100)
+	e := &challengeEvents{
+		recorder:        recorder,
+		challenges:      newChallengeCache(cmfake.NewSimpleClientset(), stopCh),
+		limiter:         flowcontrol.NewFakeAlwaysRateLimiter(),
+		isClusterScoped: newTestSolver(t).isClusterScoped,
+	}
+	cr := v1alpha1.ChallengeRequest{
+		ResourceNamespace: testNamespace,
+		DNSName:           testZone,
+		Key:               "key1",
+	}
+	// The Event should be dropped at once rather than waiting for Challenges
+	// to be cached
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	e.recordChange(ctx, cr, recordCreated, testZone, testEntryName)
+	require.NoError(t, ctx.Err())
+	require.Empty(t, recordedEvents(recorder))
+}
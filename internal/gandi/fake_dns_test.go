@@ -0,0 +1,135 @@
+package gandi
+
+import (
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDNS is a minimal, in-memory DNS server that answers queries from a fixed
+// set of records. It answers as both a recursive and an authoritative server
+// would, which is enough to exercise the solver's DNS lookups.
+type fakeDNS struct {
+	addr string
+
+	mu      sync.Mutex
+	records []dns.RR
+	// dynamic, if set, answers any query not answered by records
+	dynamic func(dns.Question) []dns.RR
+}
+
+func newFakeDNS(t *testing.T) *fakeDNS {
+	f := &fakeDNS{}
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	started := make(chan struct{})
+	srv := &dns.Server{
+		PacketConn:        conn,
+		Handler:           dns.HandlerFunc(f.serveDNS),
+		NotifyStartedFunc: func() { close(started) },
+	}
+	go func() {
+		_ = srv.ActivateAndServe()
+	}()
+	<-started
+	t.Cleanup(func() {
+		_ = srv.Shutdown()
+	})
+	f.addr = conn.LocalAddr().String()
+	return f
+}
+
+// add seeds the fake with the given records in zone file format.
+func (f *fakeDNS) add(t *testing.T, records ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		require.NoError(t, err)
+		f.records = append(f.records, rr)
+	}
+}
+
+// remove removes all records with the given name and type.
+func (f *fakeDNS) remove(name string, rrType uint16) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.records = slices.DeleteFunc(f.records, func(rr dns.RR) bool {
+		return strings.EqualFold(rr.Header().Name, name) && rr.Header().Rrtype == rrType
+	})
+}
+
+// setDynamic sets a function that answers any query not answered by the
+// fake's records.
+func (f *fakeDNS) setDynamic(dynamic func(dns.Question) []dns.RR) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.dynamic = dynamic
+}
+
+func (f *fakeDNS) serveDNS(w dns.ResponseWriter, req *dns.Msg) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	res := &dns.Msg{}
+	res.SetReply(req)
+	res.Authoritative = true
+	q := req.Question[0]
+	nameExists := false
+	for _, rr := range f.records {
+		if !strings.EqualFold(rr.Header().Name, q.Name) {
+			continue
+		}
+		nameExists = true
+		if rr.Header().Rrtype == q.Qtype || rr.Header().Rrtype == dns.TypeCNAME {
+			res.Answer = append(res.Answer, rr)
+		}
+	}
+	if len(res.Answer) == 0 && f.dynamic != nil {
+		res.Answer = f.dynamic(q)
+		nameExists = nameExists || len(res.Answer) > 0
+	}
+	if len(res.Answer) == 0 {
+		// Refer to the SOA record of the closest enclosing zone, if any
+		for name := q.Name; name != ""; name = parentName(name) {
+			if soa := f.soaLocked(name); soa != nil {
+				res.Ns = append(res.Ns, soa)
+				break
+			}
+		}
+		if !nameExists {
+			res.Rcode = dns.RcodeNameError
+		}
+	}
+	_ = w.WriteMsg(res)
+}
+
+func (f *fakeDNS) soaLocked(name string) dns.RR {
+	for _, rr := range f.records {
+		if rr.Header().Rrtype == dns.TypeSOA && strings.EqualFold(rr.Header().Name, name) {
+			return rr
+		}
+	}
+	return nil
+}
+
+// parentName returns the fully qualified name of the parent of the given fully
+// qualified name, or an empty string for the root.
+func parentName(name string) string {
+	if name == "." {
+		return ""
+	}
+	if i := strings.Index(name, "."); i < len(name)-1 {
+		return name[i+1:]
+	}
+	return "."
+}
+
+// testSOA returns an SOA record for the given zone in zone file format.
+func testSOA(zone string) string {
+	return zone + ". 300 IN SOA ns1." + zone + ". hostmaster." + zone + ". 1 3600 600 86400 300"
+}
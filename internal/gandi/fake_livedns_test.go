@@ -0,0 +1,263 @@
+package gandi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/krancovia/cert-manager-webhook-gandi/pkg/livedns"
+)
+
+// fakeLiveDNS is a minimal, in-memory imitation of the Gandi LiveDNS API. It
+// implements just enough of the API, and of its quirks, to exercise the solver
+// end to end.
+type fakeLiveDNS struct {
+	url string
+
+	mu sync.Mutex
+	// rrsets is indexed by domain, then by rrset name and type
+	rrsets map[string]map[string]*livedns.RRSet
+	// writes counts all requests that modified (or attempted to modify) a
+	// record set
+	writes int
+	// failures maps HTTP methods to a status with which all requests using that
+	// method should fail
+	failures map[string]int
+}
+
+func newFakeLiveDNS(t *testing.T) *fakeLiveDNS {
+	f := &fakeLiveDNS{
+		rrsets:   map[string]map[string]*livedns.RRSet{},
+		failures: map[string]int{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /domains/{domain}", f.getDomain)
+	mux.HandleFunc("GET /domains/{domain}/records", f.listRRSets)
+	mux.HandleFunc("GET /domains/{domain}/records/{name}/{type}", f.getRRSet)
+	mux.HandleFunc("POST /domains/{domain}/records", f.createRRSet)
+	mux.HandleFunc("PUT /domains/{domain}/records/{name}/{type}", f.updateRRSet)
+	mux.HandleFunc("DELETE /domains/{domain}/records/{name}/{type}", f.deleteRRSet)
+	srv := httptest.NewServer(f.authenticated(mux))
+	t.Cleanup(srv.Close)
+	f.url = srv.URL
+	return f
+}
+
+// set seeds the fake with the given record set, quoting TXT values as Gandi
+// would.
+func (f *fakeLiveDNS) set(domain string, rrs livedns.RRSet) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.setLocked(domain, rrs)
+}
+
+// addDomain seeds the fake with the given domain, without any record sets.
+func (f *fakeLiveDNS) addDomain(domain string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.rrsets[domain]; !ok {
+		f.rrsets[domain] = map[string]*livedns.RRSet{}
+	}
+}
+
+// get returns a copy of the record set with the given name and type in the
+// given domain, exactly as Gandi would return it, or nil if no such record set
+// exists.
+func (f *fakeLiveDNS) get(domain, name, rrType string) *livedns.RRSet {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	rrs, ok := f.rrsets[domain][rrsetKey(name, rrType)]
+	if !ok {
+		return nil
+	}
+	rrsCopy := *rrs
+	rrsCopy.Values = slices.Clone(rrs.Values)
+	return &rrsCopy
+}
+
+// failWith causes all subsequent requests using the given method to fail with
+// the given HTTP status.
+func (f *fakeLiveDNS) failWith(method string, status int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures[method] = status
+}
+
+// writeCount returns the number of requests received so far that attempted to
+// modify a record set.
+func (f *fakeLiveDNS) writeCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.writes
+}
+
+func (f *fakeLiveDNS) authenticated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			writeFakeError(w, http.StatusUnauthorized, "No credentials provided.")
+			return
+		}
+		f.mu.Lock()
+		status, fail := f.failures[r.Method]
+		f.mu.Unlock()
+		if fail {
+			writeFakeError(w, status, http.StatusText(status))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (f *fakeLiveDNS) getDomain(w http.ResponseWriter, r *http.Request) {
+	domain := r.PathValue("domain")
+	f.mu.Lock()
+	_, exists := f.rrsets[domain]
+	f.mu.Unlock()
+	if !exists {
+		writeFakeError(w, http.StatusNotFound, "The resource could not be found.")
+		return
+	}
+	writeFakeJSON(w, http.StatusOK, map[string]string{"fqdn": domain})
+}
+
+func (f *fakeLiveDNS) listRRSets(w http.ResponseWriter, r *http.Request) {
+	domain := r.PathValue("domain")
+	rrType := r.URL.Query().Get("rrset_type")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	rrsets, exists := f.rrsets[domain]
+	if !exists {
+		writeFakeError(w, http.StatusNotFound, "The resource could not be found.")
+		return
+	}
+	list := []livedns.RRSet{}
+	for _, rrs := range rrsets {
+		if rrType == "" || rrs.Type == rrType {
+			list = append(list, *rrs)
+		}
+	}
+	slices.SortFunc(list, func(a, b livedns.RRSet) int {
+		return strings.Compare(rrsetKey(a.Name, a.Type), rrsetKey(b.Name, b.Type))
+	})
+	writeFakeJSON(w, http.StatusOK, list)
+}
+
+func (f *fakeLiveDNS) getRRSet(w http.ResponseWriter, r *http.Request) {
+	rrs := f.get(r.PathValue("domain"), r.PathValue("name"), r.PathValue("type"))
+	if rrs == nil {
+		writeFakeError(w, http.StatusNotFound, "The resource could not be found.")
+		return
+	}
+	writeFakeJSON(w, http.StatusOK, rrs)
+}
+
+func (f *fakeLiveDNS) createRRSet(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.writes++
+	rrs := livedns.RRSet{}
+	if err := json.NewDecoder(r.Body).Decode(&rrs); err != nil {
+		writeFakeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	domain := r.PathValue("domain")
+	if _, exists := f.rrsets[domain][rrsetKey(rrs.Name, rrs.Type)]; exists {
+		writeFakeError(w, http.StatusConflict, "A record with that name already exists.")
+		return
+	}
+	if len(rrs.Values) == 0 {
+		writeFakeError(w, http.StatusBadRequest, "rrset_values must not be empty.")
+		return
+	}
+	f.setLocked(domain, rrs)
+	writeFakeJSON(w, http.StatusCreated, map[string]string{"message": "DNS Record Created"})
+}
+
+func (f *fakeLiveDNS) updateRRSet(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.writes++
+	rrs := livedns.RRSet{}
+	if err := json.NewDecoder(r.Body).Decode(&rrs); err != nil {
+		writeFakeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(rrs.Values) == 0 {
+		writeFakeError(w, http.StatusBadRequest, "rrset_values must not be empty.")
+		return
+	}
+	rrs.Name = r.PathValue("name")
+	rrs.Type = r.PathValue("type")
+	// Like Gandi, PUT creates the record set if it doesn't already exist.
+	f.setLocked(r.PathValue("domain"), rrs)
+	writeFakeJSON(w, http.StatusCreated, map[string]string{"message": "DNS Record Created"})
+}
+
+func (f *fakeLiveDNS) deleteRRSet(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.writes++
+	domain := r.PathValue("domain")
+	key := rrsetKey(r.PathValue("name"), r.PathValue("type"))
+	if _, exists := f.rrsets[domain][key]; !exists {
+		writeFakeError(w, http.StatusNotFound, "The resource could not be found.")
+		return
+	}
+	delete(f.rrsets[domain], key)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeLiveDNS) setLocked(domain string, rrs livedns.RRSet) {
+	if rrs.Type == "TXT" {
+		rrs.Values = quoteTxtValues(rrs.Values)
+	}
+	if _, ok := f.rrsets[domain]; !ok {
+		f.rrsets[domain] = map[string]*livedns.RRSet{}
+	}
+	f.rrsets[domain][rrsetKey(rrs.Name, rrs.Type)] = &rrs
+}
+
+func rrsetKey(name, rrType string) string {
+	return fmt.Sprintf("%s/%s", name, rrType)
+}
+
+func writeFakeError(w http.ResponseWriter, status int, message string) {
+	writeFakeJSON(w, status, livedns.APIError{
+		Code:    status,
+		Message: message,
+		Object:  fmt.Sprintf("HTTP%s", http.StatusText(status)),
+		Cause:   http.StatusText(status),
+	})
+}
+
+func writeFakeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func TestFakeLiveDNS(t *testing.T) {
+	f := newFakeLiveDNS(t)
+	c := newClient(Config{APIEndpoint: f.url}, testToken, http.DefaultClient)
+	ctx := context.Background()
+	require.NoError(t, c.createTxtRecord(ctx, testZone, testEntryName, minTTL, []string{"foo"}))
+	require.True(t, livedns.IsConflict(c.createTxtRecord(ctx, testZone, testEntryName, minTTL, []string{"foo"})))
+	rrs, err := c.getTxtRecord(ctx, testZone, testEntryName)
+	require.NoError(t, err)
+	require.Equal(t, []string{"foo"}, rrs.Values)
+	require.Equal(t, []string{`"foo"`}, f.get(testZone, testEntryName, "TXT").Values)
+	require.NoError(t, c.updateTxtRecord(ctx, testZone, testEntryName, minTTL, []string{"foo", "bar"}))
+	require.Len(t, f.get(testZone, testEntryName, "TXT").Values, 2)
+	require.NoError(t, c.deleteTxtRecord(ctx, testZone, testEntryName))
+	require.Nil(t, f.get(testZone, testEntryName, "TXT"))
+	require.True(t, livedns.IsNotFound(c.deleteTxtRecord(ctx, testZone, testEntryName)))
+	require.Equal(t, 5, f.writeCount())
+}
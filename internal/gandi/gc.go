@@ -0,0 +1,422 @@
+package gandi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	cmacme "github.com/cert-manager/cert-manager/pkg/apis/acme/v1"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/krancovia/cert-manager-webhook-gandi/pkg/livedns"
+)
+
+const (
+	// defaultGCInterval is the default time between garbage collections.
+	defaultGCInterval = 10 * time.Minute
+	// defaultGCGracePeriod is the default time for which a challenge record
+	// value must have been continuously orphaned before it is removed. It
+	// comfortably exceeds the time for which cert-manager waits for a
+	// challenge record to propagate before giving up.
+	defaultGCGracePeriod = time.Hour
+	// gcTimeout bounds the time spent on a single garbage collection.
+	gcTimeout = 5 * time.Minute
+	// challengeEntryPrefix is the prefix of the names of challenge records that
+	// the garbage collector considers even if the webhook never wrote to them.
+	challengeEntryPrefix = "_acme-challenge"
+	// acmeKeyLength is the length of every ACME DNS-01 key, which is the
+	// unpadded base64url encoding of a SHA-256 digest.
+	acmeKeyLength = 43
+)
+
+// GarbageCollectionOptions configures the periodic removal of challenge record
+// values that no Challenge owns, as are left behind if the webhook crashes
+// between presenting and cleaning up a challenge or if cert-manager deletes a
+// Challenge without cleaning it up.
+type GarbageCollectionOptions struct {
+	// Interval is the time between garbage collections. If zero, a sensible
+	// default is used.
+	Interval time.Duration
+	// GracePeriod is the time for which a value must have been continuously
+	// observed without an owning Challenge before it is removed. If zero, a
+	// sensible default is used.
+	GracePeriod time.Duration
+	// DryRun, if true, causes values that would be removed to be logged
+	// instead.
+	DryRun bool
+}
+
+// WithGarbageCollection returns a SolverOption that makes the solver
+// periodically remove challenge record values that no Challenge owns from
+// zones in which challenges it solves have been presented.
+func WithGarbageCollection(opts GarbageCollectionOptions) SolverOption {
+	return func(s *solver) {
+		s.gcOptions = &opts
+	}
+}
+
+// garbageCollector removes challenge record values that no Challenge owns.
+// Only zones for which it knows the credentials to use are considered. Those
+// are the zones in which the solver has presented a challenge since it started
+// and the zones of all Challenges it solves that have existed since then,
+// whose configuration is taken from their issuer's solver. The latter keep a
+// zone in which a challenge was presented just before the webhook restarted
+// from being forgotten for as long as its Challenge exists. A value is owned
+// by any Challenge whose key it is, regardless of the record in which it
+// appears, so that records reached by following CNAMEs are handled correctly.
+type garbageCollector struct {
+	solver      *solver
+	interval    time.Duration
+	gracePeriod time.Duration
+	dryRun      bool
+	now         func() time.Time // Overridable for testing purposes
+
+	mu sync.Mutex
+	// zones is indexed by zone name
+	zones map[string]*gcZone
+	// orphans maps each orphaned value to the time at which it was first
+	// observed without an owning Challenge
+	orphans map[gcValue]time.Time
+	// discovered holds the UIDs of live Challenges whose zones have already
+	// been tracked
+	discovered map[types.UID]struct{}
+}
+
+// gcZone is a zone in which the solver has presented challenges.
+type gcZone struct {
+	// resourceNamespace and cfg are those of the most recent challenge
+	// presented in the zone, which are used to authenticate to the LiveDNS
+	// API.
+	resourceNamespace string
+	cfg               Config
+	// entries are the names of the records in the zone to which the solver has
+	// written, which may not begin with challengeEntryPrefix if they were
+	// reached by following CNAMEs. Such records may hold values that have
+	// nothing to do with ACME, so only values that look like ACME keys are
+	// ever removed from them.
+	entries map[string]struct{}
+}
+
+// gcValue identifies a single value of a TXT record.
+type gcValue struct {
+	zone  string
+	entry string
+	value string
+}
+
+func newGarbageCollector(s *solver, opts GarbageCollectionOptions) *garbageCollector {
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = defaultGCInterval
+	}
+	gracePeriod := opts.GracePeriod
+	if gracePeriod <= 0 {
+		gracePeriod = defaultGCGracePeriod
+	}
+	return &garbageCollector{
+		solver:      s,
+		interval:    interval,
+		gracePeriod: gracePeriod,
+		dryRun:      opts.DryRun,
+		now:         time.Now,
+		zones:       map[string]*gcZone{},
+		orphans:     map[gcValue]time.Time{},
+		discovered:  map[types.UID]struct{}{},
+	}
+}
+
+// track records that a challenge with the given resource namespace and
+// configuration was presented in the given record of the given zone. Nothing
+// is tracked by a nil garbageCollector, as is used when garbage collection is
+// disabled.
+func (g *garbageCollector) track(
+	zone string,
+	entry string,
+	resourceNamespace string,
+	cfg Config,
+) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	z, ok := g.zones[zone]
+	if !ok {
+		z = &gcZone{entries: map[string]struct{}{}}
+		g.zones[zone] = z
+	}
+	z.resourceNamespace = resourceNamespace
+	z.cfg = cfg
+	z.entries[entry] = struct{}{}
+}
+
+// run collects garbage immediately, so that the zones of existing Challenges
+// are discovered promptly after a restart, and then every interval until the
+// given context is done. Nothing is removed before the grace period has
+// elapsed, so collecting immediately is harmless.
+func (g *garbageCollector) run(ctx context.Context) {
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+	for {
+		collectCtx, cancel := context.WithTimeout(ctx, gcTimeout)
+		if err := g.collect(collectCtx); err != nil {
+			g.solver.logger.Error("garbage collection failed", "error", err)
+		}
+		cancel()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// collect performs a single garbage collection. Failures pertaining to a
+// single zone don't prevent other zones from being collected.
+func (g *garbageCollector) collect(ctx context.Context) error {
+	challenges, err := g.solver.challengeCache.list(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing Challenges: %w", err)
+	}
+	owned := ownedKeys(challenges)
+	// Zones that can't be discovered are only reported. Collection proceeds in
+	// all other zones.
+	errs := []error{g.discoverZones(ctx, challenges)}
+	g.mu.Lock()
+	zones := make(map[string]gcZone, len(g.zones))
+	for name, z := range g.zones {
+		zones[name] = gcZone{
+			resourceNamespace: z.resourceNamespace,
+			cfg:               z.cfg,
+			entries:           maps.Clone(z.entries),
+		}
+	}
+	g.mu.Unlock()
+	seen := map[gcValue]struct{}{}
+	for name, z := range zones {
+		if err = g.collectZone(ctx, name, z, owned, seen); err != nil {
+			errs = append(errs, fmt.Errorf("zone %q: %w", name, err))
+		}
+	}
+	// Forget values that are gone or were not observed because their zone
+	// could not be listed; the latter start a new grace period.
+	g.mu.Lock()
+	for value := range g.orphans {
+		if _, ok := seen[value]; !ok {
+			delete(g.orphans, value)
+		}
+	}
+	g.mu.Unlock()
+	return errors.Join(errs...)
+}
+
+// ownedKeys returns the keys of all the given Challenges that are DNS-01
+// Challenges.
+func ownedKeys(challenges []*cmacme.Challenge) map[string]struct{} {
+	owned := make(map[string]struct{}, len(challenges))
+	for _, ch := range challenges {
+		if ch.Spec.Type == cmacme.ACMEChallengeTypeDNS01 {
+			owned[livedns.UnquoteTXT(ch.Spec.Key)] = struct{}{}
+		}
+	}
+	return owned
+}
+
+// discoverZones tracks the zone and record of each of the given Challenges
+// that the solver solves, using the credentials configured by the
+// Challenge's issuer. Each Challenge is resolved only once. Failures
+// pertaining to a single Challenge don't prevent others from being resolved.
+func (g *garbageCollector) discoverZones(
+	ctx context.Context,
+	challenges []*cmacme.Challenge,
+) error {
+	live := map[types.UID]struct{}{}
+	var errs []error
+	for _, ch := range challenges {
+		if !g.solves(ch) {
+			continue
+		}
+		live[ch.UID] = struct{}{}
+		g.mu.Lock()
+		_, discovered := g.discovered[ch.UID]
+		g.mu.Unlock()
+		if discovered {
+			continue
+		}
+		if err := g.discoverZone(ctx, ch); err != nil {
+			errs = append(errs, fmt.Errorf(
+				"error discovering zone of Challenge %q in namespace %q: %w",
+				ch.Name, ch.Namespace, err,
+			))
+			continue
+		}
+		g.mu.Lock()
+		g.discovered[ch.UID] = struct{}{}
+		g.mu.Unlock()
+	}
+	// Forget Challenges that no longer exist
+	g.mu.Lock()
+	for uid := range g.discovered {
+		if _, ok := live[uid]; !ok {
+			delete(g.discovered, uid)
+		}
+	}
+	g.mu.Unlock()
+	return errors.Join(errs...)
+}
+
+// solves returns true if the given Challenge is a DNS-01 Challenge solved by
+// the solver. Other webhooks may use the same solver name, so the Challenge's
+// group name must also be the solver's. If the solver's group name is unknown,
+// no Challenge is considered to be solved by it.
+func (g *garbageCollector) solves(ch *cmacme.Challenge) bool {
+	dns01 := ch.Spec.Solver.DNS01
+	return ch.Spec.Type == cmacme.ACMEChallengeTypeDNS01 &&
+		dns01 != nil &&
+		dns01.Webhook != nil &&
+		g.solver.groupName != "" &&
+		dns01.Webhook.GroupName == g.solver.groupName &&
+		dns01.Webhook.SolverName == g.solver.Name()
+}
+
+// discoverZone resolves the zone and record in which the challenge record for
+// the given Challenge is written, as the solver would when presenting it, and
+// tracks them. cert-manager doesn't record the zone it resolved, so the zone
+// is found using the LiveDNS API instead.
+func (g *garbageCollector) discoverZone(ctx context.Context, ch *cmacme.Challenge) error {
+	resourceNamespace := ch.Namespace
+	if ch.Spec.IssuerRef.Kind == cmapi.ClusterIssuerKind {
+		resourceNamespace = g.solver.clusterResourceNamespace
+	}
+	cr := v1alpha1.ChallengeRequest{
+		UID:               ch.UID,
+		ResourceNamespace: resourceNamespace,
+		DNSName:           ch.Spec.DNSName,
+		Key:               ch.Spec.Key,
+		Config:            ch.Spec.Solver.DNS01.Webhook.Config,
+	}
+	cfg, err := loadConfig(cr)
+	if err != nil {
+		return err
+	}
+	cr.ResolvedFQDN = normalizeFQDN(challengeEntryPrefix + "." + ch.Spec.DNSName)
+	if cfg.CNAME == nil && ch.Spec.Solver.DNS01.CNAMEStrategy == cmacme.FollowStrategy {
+		// cert-manager would have followed any CNAME before calling the solver
+		cfg.CNAME = &CNAMEConfig{Resolver: CNAMEResolverDNS, MaxDepth: defaultMaxCNAMEDepth}
+	}
+	lookup := &apiCNAMELookup{
+		clientFor: func(ctx context.Context, zone string) (*client, error) {
+			return g.solver.getClient(ctx, resourceNamespace, zone, cfg)
+		},
+	}
+	zone, err := lookup.findZone(ctx, cr.ResolvedFQDN)
+	if err != nil {
+		return err
+	}
+	cr.ResolvedZone = zone + "."
+	zone, entry, err := g.solver.resolveZoneAndEntry(ctx, cr, cfg)
+	if err != nil {
+		return fmt.Errorf("error resolving challenge record name: %w", err)
+	}
+	g.track(zone, entry, resourceNamespace, cfg)
+	return nil
+}
+
+// collectZone removes values from the challenge records in the given zone
+// that are not among the given owned keys and have been orphaned for at least
+// the grace period. Orphaned values that were observed are added to seen.
+func (g *garbageCollector) collectZone(
+	ctx context.Context,
+	zone string,
+	z gcZone,
+	owned map[string]struct{},
+	seen map[gcValue]struct{},
+) error {
+	cl, err := g.solver.getClient(ctx, z.resourceNamespace, zone, z.cfg)
+	if err != nil {
+		return fmt.Errorf("error getting Gandi LiveDNS API client: %w", err)
+	}
+	rrsets, err := cl.listTxtRecords(ctx, zone)
+	if err != nil {
+		return fmt.Errorf("error listing TXT records: %w", explainAPIError(err, zone))
+	}
+	var errs []error
+	for _, rrs := range rrsets {
+		challengeEntry := strings.HasPrefix(rrs.Name, challengeEntryPrefix)
+		if _, ok := z.entries[rrs.Name]; !ok && !challengeEntry {
+			continue
+		}
+		for _, value := range rrs.Values {
+			if _, ok := owned[value]; ok || (!challengeEntry && !isACMEKey(value)) {
+				continue
+			}
+			key := gcValue{zone: zone, entry: rrs.Name, value: value}
+			seen[key] = struct{}{}
+			if !g.expired(key) {
+				continue
+			}
+			if err = g.remove(ctx, cl, key); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// expired records the given orphaned value as observed and returns true if it
+// has been orphaned for at least the grace period.
+func (g *garbageCollector) expired(value gcValue) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.now()
+	firstSeen, ok := g.orphans[value]
+	if !ok {
+		g.orphans[value] = now
+		return false
+	}
+	return now.Sub(firstSeen) >= g.gracePeriod
+}
+
+// remove removes the given orphaned value or, in dry-run mode, logs that it
+// would have been removed.
+func (g *garbageCollector) remove(ctx context.Context, cl *client, value gcValue) error {
+	logger := g.solver.logger.With("zone", value.zone, "entry", value.entry, "value", value.value)
+	if g.dryRun {
+		logger.Info("would remove orphaned challenge record value (dry run)")
+		return nil
+	}
+	// Each removal is bounded like a challenge, so that the zone lock is never
+	// held for longer than a Lease is guaranteed to remain ours.
+	ctx, cancel := context.WithTimeout(ctx, challengeTimeout)
+	defer cancel()
+	if _, err := g.solver.removeKey(ctx, cl, value.zone, value.entry, value.value); err != nil {
+		return err
+	}
+	g.mu.Lock()
+	delete(g.orphans, value)
+	g.mu.Unlock()
+	logger.Info("removed orphaned challenge record value")
+	return nil
+}
+
+// isACMEKey returns true if the given value has the form of an ACME DNS-01
+// key.
+func isACMEKey(value string) bool {
+	if len(value) != acmeKeyLength {
+		return false
+	}
+	for _, r := range value {
+		switch {
+		case 'A' <= r && r <= 'Z', 'a' <= r && r <= 'z', '0' <= r && r <= '9', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,266 @@
+package gandi
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cmacme "github.com/cert-manager/cert-manager/pkg/apis/acme/v1"
+	cmclient "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned"
+	cmfake "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/require"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/krancovia/cert-manager-webhook-gandi/pkg/livedns"
+)
+
+// useTestChallenges makes the given solver find Challenges through the given
+// client and returns once they have been cached.
+func useTestChallenges(t *testing.T, s *solver, client cmclient.Interface) {
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	s.challenges = client
+	s.challengeCache = newChallengeCache(client, stopCh)
+	require.NoError(t, s.challengeCache.waitForSync(context.Background()))
+}
+
+// requireCachedChallenges waits for the given solver to have cached the given
+// number of Challenges.
+func requireCachedChallenges(t *testing.T, s *solver, count int) {
+	require.Eventually(
+		t,
+		func() bool {
+			challenges, err := s.challengeCache.list(context.Background())
+			return err == nil && len(challenges) == count
+		},
+		5*time.Second,
+		10*time.Millisecond,
+	)
+}
+
+func TestGarbageCollector(t *testing.T) {
+	const otherZone = "example.org"
+	testCases := []struct {
+		name       string
+		dryRun     bool
+		assertions func(*testing.T, *fakeLiveDNS)
+	}{
+		{
+			name: "removes orphaned values",
+			assertions: func(t *testing.T, f *fakeLiveDNS) {
+				// Values owned by a Challenge are retained
+				require.Equal(t, []string{`"key1"`}, f.get(testZone, testEntryName, "TXT").Values)
+				// Record sets left without values are deleted
+				require.Nil(t, f.get(testZone, "_acme-challenge.www", "TXT"))
+			},
+		},
+		{
+			name:   "dry run",
+			dryRun: true,
+			assertions: func(t *testing.T, f *fakeLiveDNS) {
+				require.Equal(
+					t,
+					[]string{`"key1"`, `"key2"`},
+					f.get(testZone, testEntryName, "TXT").Values,
+				)
+				require.Equal(t, []string{`"stale"`}, f.get(testZone, "_acme-challenge.www", "TXT").Values)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			f := newFakeLiveDNS(t)
+			s := newTestSolver(t)
+			useTestChallenges(t, s, cmfake.NewSimpleClientset(
+				newTestChallenge(testNamespace, "challenge-1", "key1"),
+			))
+			now := time.Now()
+			s.gc = newGarbageCollector(s, GarbageCollectionOptions{
+				GracePeriod: time.Hour,
+				DryRun:      testCase.dryRun,
+			})
+			s.gc.now = func() time.Time { return now }
+			runChallengeSteps(t, s, f, []challengeStep{present("key1"), present("key2")})
+			f.set(testZone, livedns.RRSet{
+				Type:   "TXT",
+				TTL:    minTTL,
+				Name:   "_acme-challenge.www",
+				Values: []string{"stale"},
+			})
+			// TXT records other than challenge records are never considered
+			f.set(testZone, livedns.RRSet{
+				Type:   "TXT",
+				TTL:    minTTL,
+				Name:   "@",
+				Values: []string{"v=spf1 -all"},
+			})
+			// Zones in which no challenge was presented are never considered
+			f.set(otherZone, livedns.RRSet{
+				Type:   "TXT",
+				TTL:    minTTL,
+				Name:   testEntryName,
+				Values: []string{"stale"},
+			})
+			ctx := context.Background()
+
+			// Orphaned values are retained for the grace period
+			require.NoError(t, s.gc.collect(ctx))
+			now = now.Add(59 * time.Minute)
+			require.NoError(t, s.gc.collect(ctx))
+			require.Equal(
+				t,
+				[]string{`"key1"`, `"key2"`},
+				f.get(testZone, testEntryName, "TXT").Values,
+			)
+
+			now = now.Add(time.Minute)
+			require.NoError(t, s.gc.collect(ctx))
+			testCase.assertions(t, f)
+			require.Equal(t, []string{`"v=spf1 -all"`}, f.get(testZone, "@", "TXT").Values)
+			require.Equal(t, []string{`"stale"`}, f.get(otherZone, testEntryName, "TXT").Values)
+		})
+	}
+}
+
+func TestGarbageCollectorGracePeriodRestarts(t *testing.T) {
+	f := newFakeLiveDNS(t)
+	s := newTestSolver(t)
+	challenges := cmfake.NewSimpleClientset()
+	useTestChallenges(t, s, challenges)
+	now := time.Now()
+	s.gc = newGarbageCollector(s, GarbageCollectionOptions{GracePeriod: time.Hour})
+	s.gc.now = func() time.Time { return now }
+	runChallengeSteps(t, s, f, []challengeStep{present("key1")})
+	ctx := context.Background()
+
+	require.NoError(t, s.gc.collect(ctx))
+	// The value is owned for a while, after which it is orphaned anew
+	ch := newTestChallenge(testNamespace, "challenge-1", "key1")
+	_, err := challenges.AcmeV1().Challenges(testNamespace).Create(ctx, ch, metav1.CreateOptions{})
+	require.NoError(t, err)
+	requireCachedChallenges(t, s, 1)
+	now = now.Add(30 * time.Minute)
+	require.NoError(t, s.gc.collect(ctx))
+	require.NoError(t, challenges.AcmeV1().Challenges(testNamespace).Delete(ctx, ch.Name, metav1.DeleteOptions{}))
+	requireCachedChallenges(t, s, 0)
+	now = now.Add(30 * time.Minute)
+	require.NoError(t, s.gc.collect(ctx))
+	require.NotNil(t, f.get(testZone, testEntryName, "TXT"))
+
+	now = now.Add(time.Hour)
+	require.NoError(t, s.gc.collect(ctx))
+	require.Nil(t, f.get(testZone, testEntryName, "TXT"))
+}
+
+func TestGarbageCollectorListChallengesError(t *testing.T) {
+	s := newTestSolver(t)
+	// An informer that is never started never syncs
+	stopCh := make(chan struct{})
+	close(stopCh)
+	s.challengeCache = newChallengeCache(s.challenges, stopCh)
+	s.gc = newGarbageCollector(s, GarbageCollectionOptions{})
+	require.Equal(t, defaultGCInterval, s.gc.interval)
+	require.Equal(t, defaultGCGracePeriod, s.gc.gracePeriod)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.ErrorContains(t, s.gc.collect(ctx), "error listing Challenges")
+}
+
+func TestGarbageCollectorDiscoversZones(t *testing.T) {
+	const groupName = "acme.example.com"
+	f := newFakeLiveDNS(t)
+	s := newTestSolver(t, WithGroupName(groupName))
+	// The Challenge is for a subdomain, so its zone must be found
+	ch := newTestChallenge(testNamespace, "challenge-1", "key1")
+	ch.Spec.DNSName = "www." + testZone
+	ch.Spec.Solver.DNS01 = &cmacme.ACMEChallengeSolverDNS01{
+		Webhook: &cmacme.ACMEIssuerDNS01ProviderWebhook{
+			GroupName:  groupName,
+			SolverName: s.Name(),
+			Config:     newTestChallengeRequest(t, f, "key1").Config,
+		},
+	}
+	// Another webhook using the same solver name has a configuration of its
+	// own, which must never be parsed
+	other := newTestChallenge(testNamespace, "challenge-2", "key2")
+	other.Spec.Solver.DNS01 = &cmacme.ACMEChallengeSolverDNS01{
+		Webhook: &cmacme.ACMEIssuerDNS01ProviderWebhook{
+			GroupName:  "acme.example.org",
+			SolverName: s.Name(),
+			Config:     &apiextensionsv1.JSON{Raw: []byte(`{"unknownField":true}`)},
+		},
+	}
+	challenges := cmfake.NewSimpleClientset(ch, other)
+	useTestChallenges(t, s, challenges)
+	now := time.Now()
+	s.gc = newGarbageCollector(s, GarbageCollectionOptions{GracePeriod: time.Hour})
+	s.gc.now = func() time.Time { return now }
+	// The value was presented before the webhook restarted, so the garbage
+	// collector has never tracked its zone
+	f.set(testZone, livedns.RRSet{
+		Type:   "TXT",
+		TTL:    minTTL,
+		Name:   "_acme-challenge.www",
+		Values: []string{"key1", "stale"},
+	})
+	ctx := context.Background()
+
+	require.NoError(t, s.gc.collect(ctx))
+	require.Contains(t, s.gc.zones, testZone)
+	require.Contains(t, s.gc.zones[testZone].entries, "_acme-challenge.www")
+	require.Equal(t, map[types.UID]struct{}{ch.UID: {}}, s.gc.discovered)
+	now = now.Add(time.Hour)
+	require.NoError(t, s.gc.collect(ctx))
+	require.Equal(t, []string{`"key1"`}, f.get(testZone, "_acme-challenge.www", "TXT").Values)
+
+	// The zone is remembered after the Challenge is deleted without being
+	// cleaned up
+	require.NoError(t, challenges.AcmeV1().Challenges(testNamespace).Delete(ctx, ch.Name, metav1.DeleteOptions{}))
+	requireCachedChallenges(t, s, 1)
+	require.NoError(t, s.gc.collect(ctx))
+	require.Empty(t, s.gc.discovered)
+	now = now.Add(time.Hour)
+	require.NoError(t, s.gc.collect(ctx))
+	require.Nil(t, f.get(testZone, "_acme-challenge.www", "TXT"))
+}
+
+func TestGarbageCollectorSparesUnrelatedValues(t *testing.T) {
+	const orphanedKey = "Xw2Jq0u1tMv8lBzK9cR4yHs7nPfE3aGdW6oLiT5kQbY"
+	f := newFakeLiveDNS(t)
+	s := newTestSolver(t)
+	useTestChallenges(t, s, cmfake.NewSimpleClientset())
+	now := time.Now()
+	s.gc = newGarbageCollector(s, GarbageCollectionOptions{GracePeriod: time.Hour})
+	s.gc.now = func() time.Time { return now }
+	cfg, err := loadConfig(*newTestChallengeRequest(t, f, orphanedKey))
+	require.NoError(t, err)
+	// A record reached by following a CNAME may hold values that have nothing
+	// to do with ACME
+	s.gc.track(testZone, "validation", testNamespace, cfg)
+	f.set(testZone, livedns.RRSet{
+		Type:   "TXT",
+		TTL:    minTTL,
+		Name:   "validation",
+		Values: []string{"google-site-verification=abc", orphanedKey},
+	})
+	ctx := context.Background()
+
+	require.NoError(t, s.gc.collect(ctx))
+	now = now.Add(time.Hour)
+	require.NoError(t, s.gc.collect(ctx))
+	require.Equal(
+		t,
+		[]string{`"google-site-verification=abc"`},
+		f.get(testZone, "validation", "TXT").Values,
+	)
+}
+
+func TestIsACMEKey(t *testing.T) {
+	require.True(t, isACMEKey("Xw2Jq0u1tMv8lBzK9cR4yHs7nPfE3aGdW6oLiT5kQbY"))
+	require.True(t, isACMEKey("-_2Jq0u1tMv8lBzK9cR4yHs7nPfE3aGdW6oLiT5kQbY"))
+	require.False(t, isACMEKey("Xw2Jq0u1tMv8lBzK9cR4yHs7nPfE3aGdW6oLiT5kQb"))
+	require.False(t, isACMEKey("Xw2Jq0u1tMv8lBzK9cR4yHs7nPfE3aGdW6oLiT5kQb="))
+	require.False(t, isACMEKey("v=spf1 -all"))
+}
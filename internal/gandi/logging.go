@@ -0,0 +1,112 @@
+package gandi
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+// Actions logged for calls to Present and CleanUp.
+const (
+	actionPresent = "present"
+	actionCleanUp = "cleanUp"
+)
+
+// challengeLog carries the fields common to all lines logged while presenting
+// or cleaning up a single challenge so that lines logged for concurrent
+// challenges can be told apart. It is carried by the context of each call to
+// Present or CleanUp. It is not safe for concurrent use, which is never
+// required of it because each challenge is handled by a single goroutine.
+type challengeLog struct {
+	base  *slog.Logger
+	zone  string
+	entry string
+	// httpStatus is the HTTP status of the response to the most recent LiveDNS
+	// API request, or zero if there has been none or it failed without one.
+	httpStatus int
+	start      time.Time
+}
+
+type challengeLogKey struct{}
+
+// newChallengeLog returns a challengeLog for the given action on the challenge
+// described by the given ChallengeRequest. Its zone and entry are initially
+// the ones resolved by cert-manager.
+func newChallengeLog(
+	logger *slog.Logger,
+	cr v1alpha1.ChallengeRequest,
+	action string,
+	zone string,
+	entry string,
+) *challengeLog {
+	return &challengeLog{
+		base:  logger.With("uid", cr.UID, "action", action),
+		zone:  zone,
+		entry: entry,
+		start: time.Now(),
+	}
+}
+
+// withChallengeLog returns a copy of the given context carrying the given
+// challengeLog.
+func withChallengeLog(ctx context.Context, l *challengeLog) context.Context {
+	return context.WithValue(ctx, challengeLogKey{}, l)
+}
+
+// challengeLogFrom returns the challengeLog carried by the given context or,
+// if there is none, one without challenge fields that uses the default logger.
+func challengeLogFrom(ctx context.Context) *challengeLog {
+	if l, ok := ctx.Value(challengeLogKey{}).(*challengeLog); ok {
+		return l
+	}
+	return &challengeLog{base: slog.Default(), start: time.Now()}
+}
+
+// setRecord updates the zone and entry of the challenge record, as they may
+// differ from the ones resolved by cert-manager if a CNAME has been followed.
+func (l *challengeLog) setRecord(zone string, entry string) {
+	l.zone, l.entry = zone, entry
+}
+
+// logger returns a logger that adds the current zone, entry, and HTTP status
+// to every line. Callers are expected to add a duration.
+func (l *challengeLog) logger() *slog.Logger {
+	return l.base.With(
+		"zone", l.zone,
+		"entry", l.entry,
+		"httpStatus", l.httpStatus,
+	)
+}
+
+// elapsedMs returns the time in milliseconds since the challenge started to
+// be handled.
+func (l *challengeLog) elapsedMs() int64 {
+	return time.Since(l.start).Milliseconds()
+}
+
+// logAPIRequest logs a single attempt at a LiveDNS API request and records
+// its HTTP status as the most recent one.
+func (l *challengeLog) logAPIRequest(
+	method string,
+	path string,
+	attempt int,
+	status int,
+	duration time.Duration,
+	err error,
+) {
+	l.httpStatus = status
+	level := slog.LevelDebug
+	args := []any{
+		"method", method,
+		"path", path,
+		"attempt", attempt,
+		"durationMs", duration.Milliseconds(),
+	}
+	if err != nil {
+		level = slog.LevelWarn
+		args = append(args, "error", err)
+	}
+	l.logger().Log(context.Background(), level, "LiveDNS API request", args...)
+}
@@ -0,0 +1,231 @@
+package gandi
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricsNamespace prefixes the names of all metrics exported by the solver.
+const metricsNamespace = "gandi_webhook"
+
+// Results of calls to Present and CleanUp.
+const (
+	resultSuccess = "success"
+	resultFailure = "failure"
+)
+
+// metrics holds the Prometheus metrics exported by the solver. All of its
+// methods do nothing if it is nil, as it is when metrics are disabled.
+type metrics struct {
+	requestDuration *prometheus.HistogramVec
+	throttleWait    *prometheus.HistogramVec
+	zoneLockWait    *prometheus.HistogramVec
+	challenges      *prometheus.CounterVec
+	inFlight        *prometheus.GaugeVec
+}
+
+// WithMetrics returns a SolverOption that makes the solver register its
+// metrics with the given Registerer.
+func WithMetrics(reg prometheus.Registerer) SolverOption {
+	return func(s *solver) {
+		s.metricsRegisterer = reg
+	}
+}
+
+// newMetrics returns metrics registered with the given Registerer. Statistics
+// about waiting for zone locks are read from the given zoneLockManager when
+// metrics are collected.
+func newMetrics(reg prometheus.Registerer, locks *zoneLockManager) (*metrics, error) {
+	m := &metrics{
+		requestDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: metricsNamespace,
+				Name:      "livedns_request_duration_seconds",
+				Help: "Latency of LiveDNS API requests, including any retries, by HTTP " +
+					"method, operation, and class of the final HTTP status.",
+				Buckets: prometheus.ExponentialBuckets(0.05, 2, 10),
+			},
+			[]string{"method", "operation", "status_class"},
+		),
+		throttleWait: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: metricsNamespace,
+				Name:      "livedns_rate_limit_wait_seconds",
+				Help: "Time each attempt at a LiveDNS API request spent waiting for the " +
+					"client-side rate limit of its credential, by operation.",
+				Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+			},
+			[]string{"operation"},
+		),
+		zoneLockWait: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: metricsNamespace,
+				Name:      "zone_lock_wait_seconds",
+				Help: "Time spent waiting for a zone lock, including for a zone Lease " +
+					"held by another replica, by result.",
+				Buckets: prometheus.ExponentialBuckets(0.01, 2, 14),
+			},
+			[]string{"result"},
+		),
+		challenges: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: metricsNamespace,
+				Name:      "challenges_total",
+				Help:      "Calls to Present and CleanUp by action and result.",
+			},
+			[]string{"action", "result"},
+		),
+		inFlight: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: metricsNamespace,
+				Name:      "challenges_in_flight",
+				Help:      "Calls to Present and CleanUp currently in progress by action.",
+			},
+			[]string{"action"},
+		),
+	}
+	for _, c := range []prometheus.Collector{
+		m.requestDuration,
+		m.throttleWait,
+		m.zoneLockWait,
+		m.challenges,
+		m.inFlight,
+		&zoneLockCollector{locks: locks},
+	} {
+		if err := reg.Register(c); err != nil {
+			return nil, fmt.Errorf("error registering metrics: %w", err)
+		}
+	}
+	return m, nil
+}
+
+// observeRequest records the latency of a LiveDNS API request with the given
+// method and operation that ended with the given HTTP status, which is zero if
+// no response was received.
+func (m *metrics) observeRequest(
+	method string,
+	operation string,
+	status int,
+	duration time.Duration,
+) {
+	if m == nil {
+		return
+	}
+	m.requestDuration.WithLabelValues(method, operation, statusClass(status)).
+		Observe(duration.Seconds())
+}
+
+// observeThrottle records the time an attempt at a LiveDNS API request with
+// the given operation spent waiting for the client-side rate limit.
+func (m *metrics) observeThrottle(operation string, wait time.Duration) {
+	if m == nil {
+		return
+	}
+	m.throttleWait.WithLabelValues(operation).Observe(wait.Seconds())
+}
+
+// observeZoneLockWait records the time spent waiting for a zone lock by a
+// caller that acquired it or, if the given error is non-nil, gave up.
+func (m *metrics) observeZoneLockWait(wait time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	result := resultSuccess
+	if err != nil {
+		result = resultFailure
+	}
+	m.zoneLockWait.WithLabelValues(result).Observe(wait.Seconds())
+}
+
+// startChallenge records the start of the given action on a challenge. It
+// returns a function that records its end with the given error.
+func (m *metrics) startChallenge(action string) func(error) {
+	if m == nil {
+		return func(error) {}
+	}
+	inFlight := m.inFlight.WithLabelValues(action)
+	inFlight.Inc()
+	return func(err error) {
+		inFlight.Dec()
+		result := resultSuccess
+		if err != nil {
+			result = resultFailure
+		}
+		m.challenges.WithLabelValues(action, result).Inc()
+	}
+}
+
+// statusClass returns the class, such as "2xx", of the given HTTP status, or
+// "error" if there was no response.
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "error"
+	}
+	return fmt.Sprintf("%dxx", status/100)
+}
+
+var (
+	zoneLockAcquisitionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "zone_lock", "acquisitions_total"),
+		"Number of times a zone lock was acquired.",
+		nil, nil,
+	)
+	zoneLockTimeoutsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "zone_lock", "timeouts_total"),
+		"Number of times a caller gave up waiting for a zone lock.",
+		nil, nil,
+	)
+	zoneLockWaitDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "zone_lock", "wait_seconds_total"),
+		"Cumulative time spent waiting for zone locks, including by callers that gave up.",
+		nil, nil,
+	)
+	zoneLockMaxWaitDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "zone_lock", "max_wait_seconds"),
+		"Longest time any single caller has spent waiting for a zone lock.",
+		nil, nil,
+	)
+)
+
+// zoneLockCollector exports the statistics a zoneLockManager keeps about time
+// spent waiting for zone locks within the process. Time spent waiting for zone
+// Leases held by other replicas is only measured by the zone_lock_wait_seconds
+// histogram.
+type zoneLockCollector struct {
+	locks *zoneLockManager
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *zoneLockCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- zoneLockAcquisitionsDesc
+	ch <- zoneLockTimeoutsDesc
+	ch <- zoneLockWaitDesc
+	ch <- zoneLockMaxWaitDesc
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *zoneLockCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.locks.waitStats()
+	ch <- prometheus.MustNewConstMetric(
+		zoneLockAcquisitionsDesc,
+		prometheus.CounterValue,
+		float64(stats.Acquisitions),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		zoneLockTimeoutsDesc,
+		prometheus.CounterValue,
+		float64(stats.Timeouts),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		zoneLockWaitDesc,
+		prometheus.CounterValue,
+		stats.TotalWait.Seconds(),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		zoneLockMaxWaitDesc,
+		prometheus.GaugeValue,
+		stats.MaxWait.Seconds(),
+	)
+}
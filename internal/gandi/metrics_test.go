@@ -0,0 +1,83 @@
+package gandi
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSolverMetrics(t *testing.T) {
+	f := newFakeLiveDNS(t)
+	reg := prometheus.NewRegistry()
+	s := newTestSolver(t, WithMetrics(reg))
+	require.NoError(t, s.Initialize(nil, nil))
+	runChallengeSteps(t, s, f, []challengeStep{present("key1"), cleanUp("key1")})
+	f.failWith(http.MethodPost, http.StatusForbidden)
+	require.Error(t, s.Present(newTestChallengeRequest(t, f, "key2")))
+
+	require.NoError(t, testutil.GatherAndCompare(
+		reg,
+		strings.NewReader(`
+# HELP gandi_webhook_challenges_total Calls to Present and CleanUp by action and result.
+# TYPE gandi_webhook_challenges_total counter
+gandi_webhook_challenges_total{action="cleanUp",result="success"} 1
+gandi_webhook_challenges_total{action="present",result="failure"} 1
+gandi_webhook_challenges_total{action="present",result="success"} 1
+# HELP gandi_webhook_challenges_in_flight Calls to Present and CleanUp currently in progress by action.
+# TYPE gandi_webhook_challenges_in_flight gauge
+gandi_webhook_challenges_in_flight{action="cleanUp"} 0
+gandi_webhook_challenges_in_flight{action="present"} 0
+# HELP gandi_webhook_zone_lock_acquisitions_total Number of times a zone lock was acquired.
+# TYPE gandi_webhook_zone_lock_acquisitions_total counter
+gandi_webhook_zone_lock_acquisitions_total 3
+# HELP gandi_webhook_zone_lock_timeouts_total Number of times a caller gave up waiting for a zone lock.
+# TYPE gandi_webhook_zone_lock_timeouts_total counter
+gandi_webhook_zone_lock_timeouts_total 0
+`),
+		"gandi_webhook_challenges_total",
+		"gandi_webhook_challenges_in_flight",
+		"gandi_webhook_zone_lock_acquisitions_total",
+		"gandi_webhook_zone_lock_timeouts_total",
+	))
+
+	requests := s.metrics.requestDuration
+	require.Equal(t, 5, testutil.CollectAndCount(requests))
+	for _, labels := range [][]string{
+		{http.MethodGet, "getRecord", "4xx"},
+		{http.MethodPost, "createTxtRecord", "2xx"},
+		{http.MethodPost, "createTxtRecord", "4xx"},
+		{http.MethodDelete, "deleteTxtRecord", "2xx"},
+		{http.MethodGet, "getRecord", "2xx"},
+	} {
+		_, err := requests.GetMetricWithLabelValues(labels...)
+		require.NoError(t, err)
+	}
+	// Every attempt at a request should have been measured for throttling
+	require.Equal(t, 3, testutil.CollectAndCount(s.metrics.throttleWait))
+
+	// Every zone lock acquisition should have been measured
+	lockWait, err := s.metrics.zoneLockWait.GetMetricWithLabelValues(resultSuccess)
+	require.NoError(t, err)
+	var m dto.Metric
+	require.NoError(t, lockWait.(prometheus.Histogram).Write(&m)) // nolint: forcetypeassert
+	require.Equal(t, uint64(3), m.GetHistogram().GetSampleCount())
+}
+
+func TestStatusClass(t *testing.T) {
+	require.Equal(t, "2xx", statusClass(http.StatusNoContent))
+	require.Equal(t, "4xx", statusClass(http.StatusNotFound))
+	require.Equal(t, "5xx", statusClass(http.StatusServiceUnavailable))
+	require.Equal(t, "error", statusClass(0))
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *metrics
+	m.observeRequest(http.MethodGet, "getRecord", http.StatusOK, 0)
+	m.observeZoneLockWait(0, nil)
+	m.startChallenge(actionPresent)(nil)
+}
@@ -0,0 +1,138 @@
+package gandi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/krancovia/cert-manager-webhook-gandi/pkg/livedns"
+)
+
+// waitForPropagation blocks until the given key is served, if present is true,
+// or is no longer served, if present is false, as a value of the TXT record
+// with the given name in the given zone by all of the zone's authoritative
+// nameservers. It gives up when the timeout in the given configuration
+// expires or the given context, which bounds the challenge as a whole, is
+// done, whichever comes first, so that Present and CleanUp never outlast the
+// challenge timeout.
+func (s *solver) waitForPropagation(
+	ctx context.Context,
+	cfg PropagationConfig,
+	zone string,
+	entry string,
+	key string,
+	present bool,
+) error {
+	log := challengeLogFrom(ctx)
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout.Duration)
+	defer cancel()
+	nameservers := cfg.Nameservers
+	if len(nameservers) == 0 {
+		resolver, err := newRecursiveDNSResolver(cfg.Resolvers)
+		if err != nil {
+			return err
+		}
+		if nameservers, err = resolver.lookupNS(ctx, zone); err != nil {
+			return fmt.Errorf(
+				"error looking up authoritative nameservers of zone %q: %w",
+				zone, err,
+			)
+		}
+	}
+	fqdn := normalizeFQDN(zone)
+	if entry != "@" {
+		fqdn = normalizeFQDN(entry + "." + zone)
+	}
+	start := time.Now()
+	if err := waitForTXT(
+		ctx,
+		newDNSResolver(nameservers, false),
+		fqdn,
+		livedns.UnquoteTXT(key),
+		present,
+		cfg.PollInterval.Duration,
+	); err != nil {
+		return err
+	}
+	log.logger().Info(
+		fmt.Sprintf("TXT record %s on all authoritative nameservers", propagationState(present)),
+		"fqdn", fqdn,
+		"nameservers", nameservers,
+		"waitedMs", time.Since(start).Milliseconds(),
+		"durationMs", log.elapsedMs(),
+	)
+	return nil
+}
+
+// waitForTXT polls each of the resolver's nameservers until all of them serve,
+// if present is true, or no longer serve, if present is false, the given value
+// of the TXT record with the given name, or until the given context is done.
+// Nameservers that fail to respond are retried like those that have yet to
+// catch up.
+func waitForTXT(
+	ctx context.Context,
+	r *dnsResolver,
+	fqdn string,
+	value string,
+	present bool,
+	pollInterval time.Duration,
+) error {
+	pending := r.nameservers
+	for {
+		stillPending := []string{}
+		errs := []error{}
+		for _, ns := range pending {
+			served, err := r.servesTXT(ctx, ns, fqdn, value)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			if err != nil || served != present {
+				stillPending = append(stillPending, ns)
+			}
+		}
+		if len(stillPending) == 0 {
+			return nil
+		}
+		pending = stillPending
+		if err := sleep(ctx, pollInterval); err != nil {
+			errs = append([]error{err}, errs...)
+			return fmt.Errorf(
+				"gave up waiting for TXT record %q to be %s on %s: %w",
+				fqdn, propagationState(present), strings.Join(pending, ", "),
+				errors.Join(errs...),
+			)
+		}
+	}
+}
+
+// servesTXT returns true if the given nameserver serves the given value of
+// the TXT record with the given name.
+func (r *dnsResolver) servesTXT(
+	ctx context.Context,
+	ns string,
+	fqdn string,
+	value string,
+) (bool, error) {
+	res, err := r.queryServer(ctx, ns, fqdn, dns.TypeTXT)
+	if err != nil {
+		return false, err
+	}
+	for _, rr := range res.Answer {
+		// Long values are split into multiple strings of up to 255 bytes each
+		if txt, ok := rr.(*dns.TXT); ok && strings.Join(txt.Txt, "") == value {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func propagationState(present bool) string {
+	if present {
+		return "visible"
+	}
+	return "gone"
+}
@@ -0,0 +1,186 @@
+package gandi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testFQDN = testEntryName + "." + testZone + "."
+
+func TestWaitForTXT(t *testing.T) {
+	testCases := []struct {
+		name       string
+		present    bool
+		setup      func(t *testing.T, fast, slow *fakeDNS)
+		assertions func(t *testing.T, slow *fakeDNS, err error)
+	}{
+		{
+			name:    "value becomes visible everywhere",
+			present: true,
+			setup: func(t *testing.T, fast, slow *fakeDNS) {
+				fast.add(t, testFQDN+` 300 IN TXT "unrelated" "key1"`)
+				fast.add(t, testFQDN+` 300 IN TXT "key1"`)
+				go func() {
+					time.Sleep(100 * time.Millisecond)
+					slow.add(t, testFQDN+` 300 IN TXT "key1"`)
+				}()
+			},
+			assertions: func(t *testing.T, _ *fakeDNS, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:    "value never becomes visible on one nameserver",
+			present: true,
+			setup: func(t *testing.T, fast, _ *fakeDNS) {
+				fast.add(t, testFQDN+` 300 IN TXT "key1"`)
+			},
+			assertions: func(t *testing.T, slow *fakeDNS, err error) {
+				require.ErrorContains(t, err, "gave up waiting for TXT record")
+				require.ErrorContains(t, err, "to be visible on "+slow.addr+":")
+				require.ErrorIs(t, err, context.DeadlineExceeded)
+			},
+		},
+		{
+			name:    "split values are joined",
+			present: true,
+			setup: func(t *testing.T, fast, slow *fakeDNS) {
+				fast.add(t, testFQDN+` 300 IN TXT "ke" "y1"`)
+				slow.add(t, testFQDN+` 300 IN TXT "ke" "y1"`)
+			},
+			assertions: func(t *testing.T, _ *fakeDNS, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:    "value disappears everywhere",
+			present: false,
+			setup: func(t *testing.T, fast, slow *fakeDNS) {
+				fast.add(t, testFQDN+` 300 IN TXT "unrelated"`)
+				slow.add(t, testFQDN+` 300 IN TXT "key1"`)
+				go func() {
+					time.Sleep(100 * time.Millisecond)
+					slow.remove(testFQDN, dns.TypeTXT)
+				}()
+			},
+			assertions: func(t *testing.T, _ *fakeDNS, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:    "value never disappears",
+			present: false,
+			setup: func(t *testing.T, _, slow *fakeDNS) {
+				slow.add(t, testFQDN+` 300 IN TXT "key1"`)
+			},
+			assertions: func(t *testing.T, slow *fakeDNS, err error) {
+				require.ErrorContains(t, err, "to be gone on "+slow.addr+":")
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			fast := newFakeDNS(t)
+			slow := newFakeDNS(t)
+			testCase.setup(t, fast, slow)
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			testCase.assertions(
+				t,
+				slow,
+				waitForTXT(
+					ctx,
+					newDNSResolver([]string{fast.addr, slow.addr}, false),
+					testFQDN,
+					"key1",
+					testCase.present,
+					10*time.Millisecond,
+				),
+			)
+		})
+	}
+}
+
+func TestWaitForTXTUnreachableNameserver(t *testing.T) {
+	r := newDNSResolver([]string{"127.0.0.1:1"}, false)
+	r.udp.Timeout = 100 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	err := waitForTXT(ctx, r, testFQDN, "key1", true, 10*time.Millisecond)
+	require.ErrorContains(t, err, "error querying 127.0.0.1:1")
+}
+
+func TestSolverWaitsForPropagation(t *testing.T) {
+	f := newFakeLiveDNS(t)
+	d := newFakeDNS(t)
+	// The nameserver serves a snapshot of what LiveDNS has that is refreshed
+	// only every third query, mimicking propagation delay.
+	queries := atomic.Int32{}
+	var snapshot []dns.RR
+	d.setDynamic(func(q dns.Question) []dns.RR {
+		if q.Qtype != dns.TypeTXT || !strings.EqualFold(q.Name, testFQDN) {
+			return nil
+		}
+		if queries.Add(1)%3 == 0 {
+			snapshot = nil
+			if rrs := f.get(testZone, testEntryName, "TXT"); rrs != nil {
+				rr, err := dns.NewRR(fmt.Sprintf(
+					"%s 300 IN TXT %s",
+					testFQDN, strings.Join(rrs.Values, " "),
+				))
+				require.NoError(t, err)
+				snapshot = []dns.RR{rr}
+			}
+		}
+		return snapshot
+	})
+	s := newTestSolver(t)
+	cr := newTestChallengeRequest(t, f, "key1")
+	cfg := map[string]any{}
+	require.NoError(t, json.Unmarshal(cr.Config.Raw, &cfg))
+	cfg["propagation"] = map[string]any{
+		"nameservers":  []string{d.addr},
+		"pollInterval": "10ms",
+		"timeout":      "5s",
+	}
+	var err error
+	cr.Config.Raw, err = json.Marshal(cfg)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Present(cr))
+	require.Equal(t, int32(3), queries.Load())
+	require.NoError(t, s.CleanUp(cr))
+	require.Equal(t, int32(6), queries.Load())
+}
+
+func TestSolverPropagationBoundedByChallenge(t *testing.T) {
+	// The nameserver never serves the value
+	d := newFakeDNS(t)
+	s := newTestSolver(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := s.waitForPropagation(
+		ctx,
+		PropagationConfig{
+			Timeout:      &metav1.Duration{Duration: 10 * time.Second},
+			PollInterval: &metav1.Duration{Duration: 10 * time.Millisecond},
+			Nameservers:  []string{d.addr},
+		},
+		testZone,
+		testEntryName,
+		"key1",
+		true,
+	)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), 5*time.Second)
+}
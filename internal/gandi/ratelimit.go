@@ -0,0 +1,203 @@
+package gandi
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/utils/clock"
+)
+
+// Response headers by which Gandi reports the state of a credential's rate
+// limit.
+const (
+	rateLimitRemainingHeader = "X-RateLimit-Remaining"
+	rateLimitResetHeader     = "X-RateLimit-Reset"
+)
+
+// maxRateLimitResetDelta is the largest value of the X-RateLimit-Reset header
+// that is interpreted as a number of seconds. Larger values are interpreted as
+// a Unix time.
+const maxRateLimitResetDelta = 24 * 60 * 60
+
+// rateLimits describes the rate at which LiveDNS API requests may be made with
+// a single credential.
+type rateLimits struct {
+	// requestsPerSecond is the sustained rate at which requests may be made.
+	requestsPerSecond float64
+	// burst is the number of requests that may be made at once after a period
+	// of inactivity.
+	burst int
+}
+
+// defaultRateLimits comfortably undercuts the limit of 1000 requests per
+// minute that Gandi enforces per credential, leaving room for other clients
+// sharing the credential.
+var defaultRateLimits = rateLimits{
+	requestsPerSecond: 10,
+	burst:             20,
+}
+
+// rateLimiter is a token bucket that limits the rate at which LiveDNS API
+// requests are made with a single credential, so that a burst of challenges
+// is spread out instead of exhausting the credential's rate limit and failing
+// together. It adapts to the rate limit reported by Gandi, which may already
+// be partially exhausted by other clients sharing the credential. All of its
+// methods do nothing if it is nil, as it is for clients used outside of a
+// clientPool.
+type rateLimiter struct {
+	clock clock.Clock
+
+	mu     sync.Mutex
+	limits rateLimits
+	// tokens is the number of requests that may currently be made without
+	// waiting. It is negative if callers are waiting for tokens.
+	tokens float64
+	// last is the time at which tokens was last brought up to date.
+	last time.Time
+	// pausedUntil is the time before which Gandi has indicated it will refuse
+	// further requests. No tokens accrue before then.
+	pausedUntil time.Time
+}
+
+func newRateLimiter(clk clock.Clock, limits rateLimits) *rateLimiter {
+	return &rateLimiter{
+		clock:  clk,
+		limits: limits,
+		tokens: float64(limits.burst),
+		last:   clk.Now(),
+	}
+}
+
+// setLimits replaces the limiter's limits. Tokens already accrued are kept, up
+// to the new burst.
+func (l *rateLimiter) setLimits(limits rateLimits) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if limits == l.limits {
+		return
+	}
+	l.advance(l.clock.Now())
+	l.limits = limits
+	l.tokens = min(l.tokens, float64(limits.burst))
+}
+
+// wait blocks until a request may be made or the given context is done,
+// whichever comes first. It returns the time spent waiting.
+func (l *rateLimiter) wait(ctx context.Context) (time.Duration, error) {
+	if l == nil {
+		return 0, nil
+	}
+	delay := l.reserve()
+	if delay <= 0 {
+		return 0, nil
+	}
+	start := l.clock.Now()
+	timer := l.clock.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		l.unreserve()
+		return l.clock.Since(start), ctx.Err()
+	case <-timer.C():
+		return l.clock.Since(start), nil
+	}
+}
+
+// reserve takes a token and returns the time to wait before it may be used.
+func (l *rateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	l.advance(now)
+	l.tokens--
+	var delay time.Duration
+	if l.pausedUntil.After(now) {
+		delay = l.pausedUntil.Sub(now)
+	}
+	if l.tokens < 0 {
+		delay += time.Duration(-l.tokens / l.limits.requestsPerSecond * float64(time.Second))
+	}
+	return delay
+}
+
+// unreserve returns a token taken by a caller that gave up waiting for it.
+func (l *rateLimiter) unreserve() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance(l.clock.Now())
+	l.tokens = min(l.tokens+1, float64(l.limits.burst))
+}
+
+// observe adapts the limiter to the rate limit reported in a response with
+// the given status and header. A credential that Gandi reports as exhausted
+// is paused until its limit resets, and one refused with a 429 is paused for
+// as long as Gandi asks.
+func (l *rateLimiter) observe(status int, header http.Header) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	l.advance(now)
+	if remaining, err := strconv.Atoi(header.Get(rateLimitRemainingHeader)); err == nil && remaining >= 0 {
+		l.tokens = min(l.tokens, float64(remaining))
+		if remaining == 0 {
+			if reset, ok := parseRateLimitReset(header.Get(rateLimitResetHeader), now); ok {
+				l.pause(now.Add(reset))
+			}
+		}
+	}
+	if status == http.StatusTooManyRequests {
+		if retryAfter, ok := parseRetryAfter(header.Get("Retry-After"), now); ok {
+			l.pause(now.Add(retryAfter))
+		}
+	}
+}
+
+// pause stops tokens from accruing and being handed out until the given time.
+// The caller must hold l.mu.
+func (l *rateLimiter) pause(until time.Time) {
+	if until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+	l.tokens = min(l.tokens, 0)
+}
+
+// advance adds the tokens accrued since tokens was last brought up to date.
+// The caller must hold l.mu.
+func (l *rateLimiter) advance(now time.Time) {
+	from := l.last
+	if l.pausedUntil.After(from) {
+		from = l.pausedUntil
+	}
+	if now.After(from) {
+		l.tokens = min(
+			l.tokens+now.Sub(from).Seconds()*l.limits.requestsPerSecond,
+			float64(l.limits.burst),
+		)
+	}
+	if now.After(l.last) {
+		l.last = now
+	}
+}
+
+// parseRateLimitReset parses the value of an X-RateLimit-Reset header, which
+// is expected to be a number of seconds but is also accepted as a Unix time.
+// It returns false if the header is absent or cannot be parsed.
+func parseRateLimitReset(header string, now time.Time) (time.Duration, bool) {
+	secs, err := strconv.ParseInt(header, 10, 64)
+	if err != nil || secs < 0 {
+		return 0, false
+	}
+	if secs > maxRateLimitResetDelta {
+		return max(time.Unix(secs, 0).Sub(now), 0), true
+	}
+	return time.Duration(secs) * time.Second, true
+}
@@ -0,0 +1,199 @@
+package gandi
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestRateLimiter(t *testing.T) {
+	testCases := []struct {
+		name       string
+		limits     rateLimits
+		status     int
+		header     http.Header
+		reserved   int
+		assertions func(*testing.T, *rateLimiter, time.Duration)
+	}{
+		{
+			name:     "burst is not throttled",
+			limits:   rateLimits{requestsPerSecond: 1, burst: 3},
+			reserved: 2,
+			assertions: func(t *testing.T, _ *rateLimiter, delay time.Duration) {
+				require.Zero(t, delay)
+			},
+		},
+		{
+			name:     "requests beyond the burst are spread out",
+			limits:   rateLimits{requestsPerSecond: 2, burst: 3},
+			reserved: 4,
+			assertions: func(t *testing.T, _ *rateLimiter, delay time.Duration) {
+				require.Equal(t, time.Second, delay)
+			},
+		},
+		{
+			name:     "remaining requests reported by Gandi are honored",
+			limits:   rateLimits{requestsPerSecond: 1, burst: 10},
+			header:   newHeader(rateLimitRemainingHeader, "1"),
+			reserved: 1,
+			assertions: func(t *testing.T, _ *rateLimiter, delay time.Duration) {
+				require.Equal(t, time.Second, delay)
+			},
+		},
+		{
+			name:   "exhausted rate limit pauses until reset",
+			limits: rateLimits{requestsPerSecond: 1, burst: 10},
+			header: newHeader(rateLimitRemainingHeader, "0", rateLimitResetHeader, "30"),
+			assertions: func(t *testing.T, _ *rateLimiter, delay time.Duration) {
+				require.Equal(t, 31*time.Second, delay)
+			},
+		},
+		{
+			name:   "429 pauses for as long as Gandi asks",
+			limits: rateLimits{requestsPerSecond: 1, burst: 10},
+			status: http.StatusTooManyRequests,
+			header: newHeader("Retry-After", "5"),
+			assertions: func(t *testing.T, _ *rateLimiter, delay time.Duration) {
+				require.Equal(t, 6*time.Second, delay)
+			},
+		},
+		{
+			name:   "unparsable headers are ignored",
+			limits: rateLimits{requestsPerSecond: 1, burst: 10},
+			status: http.StatusTooManyRequests,
+			header: newHeader(rateLimitRemainingHeader, "lots", "Retry-After", "soon"),
+			assertions: func(t *testing.T, _ *rateLimiter, delay time.Duration) {
+				require.Zero(t, delay)
+			},
+		},
+		{
+			name:     "lowering the burst discards excess tokens",
+			limits:   rateLimits{requestsPerSecond: 1, burst: 10},
+			reserved: 1,
+			assertions: func(t *testing.T, l *rateLimiter, _ time.Duration) {
+				l.setLimits(rateLimits{requestsPerSecond: 1, burst: 2})
+				require.Zero(t, l.reserve())
+				require.Zero(t, l.reserve())
+				require.Equal(t, time.Second, l.reserve())
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			clk := clocktesting.NewFakeClock(time.Now())
+			l := newRateLimiter(clk, testCase.limits)
+			l.observe(testCase.status, testCase.header)
+			for range testCase.reserved {
+				l.reserve()
+			}
+			testCase.assertions(t, l, l.reserve())
+		})
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	clk := clocktesting.NewFakeClock(time.Now())
+	l := newRateLimiter(clk, rateLimits{requestsPerSecond: 1, burst: 1})
+
+	throttled, err := l.wait(context.Background())
+	require.NoError(t, err)
+	require.Zero(t, throttled)
+
+	// The next caller must wait for a token to accrue
+	type result struct {
+		throttled time.Duration
+		err       error
+	}
+	results := make(chan result)
+	go func() {
+		d, waitErr := l.wait(context.Background())
+		results <- result{d, waitErr}
+	}()
+	require.Eventually(t, clk.HasWaiters, time.Second, time.Millisecond)
+	clk.Step(time.Second)
+	res := <-results
+	require.NoError(t, res.err)
+	require.Equal(t, time.Second, res.throttled)
+
+	// A caller that gives up must return its token
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		d, waitErr := l.wait(ctx)
+		results <- result{d, waitErr}
+	}()
+	require.Eventually(t, clk.HasWaiters, time.Second, time.Millisecond)
+	cancel()
+	res = <-results
+	require.ErrorIs(t, res.err, context.Canceled)
+	clk.Step(time.Second)
+	require.Zero(t, l.reserve())
+}
+
+func TestNilRateLimiter(t *testing.T) {
+	var l *rateLimiter
+	l.setLimits(defaultRateLimits)
+	l.observe(http.StatusTooManyRequests, newHeader("Retry-After", "5"))
+	throttled, err := l.wait(context.Background())
+	require.NoError(t, err)
+	require.Zero(t, throttled)
+}
+
+// newHeader returns a header with the given alternating names and values,
+// canonicalized as they would be in a response.
+func newHeader(kv ...string) http.Header {
+	header := http.Header{}
+	for i := 0; i+1 < len(kv); i += 2 {
+		header.Set(kv[i], kv[i+1])
+	}
+	return header
+}
+
+func TestParseRateLimitReset(t *testing.T) {
+	now := time.Date(2024, time.October, 1, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name   string
+		header string
+		reset  time.Duration
+		ok     bool
+	}{
+		{
+			name: "absent",
+		},
+		{
+			name:   "seconds",
+			header: "42",
+			reset:  42 * time.Second,
+			ok:     true,
+		},
+		{
+			name:   "Unix time",
+			header: "1727784060", // One minute after now
+			reset:  time.Minute,
+			ok:     true,
+		},
+		{
+			name:   "Unix time in the past",
+			header: "1727783940",
+			ok:     true,
+		},
+		{
+			name:   "negative",
+			header: "-1",
+		},
+		{
+			name:   "garbage",
+			header: "soon",
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			reset, ok := parseRateLimitReset(testCase.header, now)
+			require.Equal(t, testCase.ok, ok)
+			require.Equal(t, testCase.reset, reset)
+		})
+	}
+}
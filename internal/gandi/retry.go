@@ -0,0 +1,114 @@
+package gandi
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// retryPolicy describes how failed LiveDNS API requests are retried.
+type retryPolicy struct {
+	// maxAttempts is the maximum number of attempts made for a single request,
+	// including the first one. A value of 1 disables retries.
+	maxAttempts int
+	// initialBackoff is the base delay before the first retry. The base delay
+	// doubles with every subsequent retry.
+	initialBackoff time.Duration
+	// maxBackoff caps the base delay between two attempts.
+	maxBackoff time.Duration
+	// maxElapsed is the total time budget for a single request, including all
+	// retries and the delays between them. No further attempt is made if it
+	// could not start before the budget is exhausted.
+	maxElapsed time.Duration
+}
+
+var defaultRetryPolicy = retryPolicy{
+	maxAttempts:    5,
+	initialBackoff: 500 * time.Millisecond,
+	maxBackoff:     8 * time.Second,
+	maxElapsed:     30 * time.Second,
+}
+
+// backoff returns the delay to observe before making the given attempt (where
+// the first attempt is attempt 1). The delay grows exponentially with each
+// attempt and is jittered to avoid many challenges retrying in lockstep.
+func (r retryPolicy) backoff(attempt int) time.Duration {
+	base := r.initialBackoff
+	for i := 2; i < attempt && base < r.maxBackoff; i++ {
+		base *= 2
+	}
+	base = min(base, r.maxBackoff)
+	if base <= 0 {
+		return 0
+	}
+	// Wait at least half the base delay and at most the full base delay.
+	half := base / 2
+	return half + rand.N(base-half+1) // nolint: gosec
+}
+
+// isRetryable determines whether a request made with the given method should
+// be retried after it failed with the given error or returned the given HTTP
+// status.
+//
+// Requests that are safe to repeat (GET, PUT, and DELETE) are retried on any
+// transport error and on any status that indicates a transient problem with
+// Gandi or an intermediary. A POST is only retried when it is certain it was
+// not acted upon: when a connection to the server could never be established,
+// or when the server explicitly declined to process it.
+func isRetryable(method string, status int, err error) bool {
+	idempotent := method != http.MethodPost && method != http.MethodPatch
+	if err != nil {
+		if errors.Is(err, context.Canceled) ||
+			errors.Is(err, context.DeadlineExceeded) {
+			return false
+		}
+		if idempotent {
+			return true
+		}
+		opErr := &net.OpError{}
+		return errors.As(err, &opErr) && opErr.Op == "dial"
+	}
+	switch status {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent
+	}
+	return false
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which may be
+// expressed either as a number of seconds or as an HTTP date. It returns false
+// if the header is absent or cannot be parsed.
+func parseRetryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(header); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// sleep blocks for the given duration or until the context is canceled,
+// whichever comes first.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,160 @@
+package gandi
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := retryPolicy{
+		initialBackoff: 100 * time.Millisecond,
+		maxBackoff:     time.Second,
+	}
+	testCases := []struct {
+		attempt int
+		base    time.Duration
+	}{
+		{attempt: 2, base: 100 * time.Millisecond},
+		{attempt: 3, base: 200 * time.Millisecond},
+		{attempt: 4, base: 400 * time.Millisecond},
+		{attempt: 5, base: 800 * time.Millisecond},
+		{attempt: 6, base: time.Second},
+		{attempt: 20, base: time.Second},
+	}
+	for _, testCase := range testCases {
+		for range 100 {
+			backoff := policy.backoff(testCase.attempt)
+			require.GreaterOrEqual(t, backoff, testCase.base/2)
+			require.LessOrEqual(t, backoff, testCase.base)
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	readErr := &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}
+	testCases := []struct {
+		name      string
+		method    string
+		status    int
+		err       error
+		retryable bool
+	}{
+		{
+			name:      "GET on connection reset",
+			method:    http.MethodGet,
+			err:       readErr,
+			retryable: true,
+		},
+		{
+			name:   "GET on context canceled",
+			method: http.MethodGet,
+			err:    context.Canceled,
+		},
+		{
+			name:      "POST on failure to connect",
+			method:    http.MethodPost,
+			err:       dialErr,
+			retryable: true,
+		},
+		{
+			name:   "POST on connection reset",
+			method: http.MethodPost,
+			err:    readErr,
+		},
+		{
+			name:      "DELETE on 502",
+			method:    http.MethodDelete,
+			status:    http.StatusBadGateway,
+			retryable: true,
+		},
+		{
+			name:   "POST on 502",
+			method: http.MethodPost,
+			status: http.StatusBadGateway,
+		},
+		{
+			name:      "POST on 429",
+			method:    http.MethodPost,
+			status:    http.StatusTooManyRequests,
+			retryable: true,
+		},
+		{
+			name:      "PUT on 503",
+			method:    http.MethodPut,
+			status:    http.StatusServiceUnavailable,
+			retryable: true,
+		},
+		{
+			name:   "PUT on 500",
+			method: http.MethodPut,
+			status: http.StatusInternalServerError,
+		},
+		{
+			name:   "GET on 404",
+			method: http.MethodGet,
+			status: http.StatusNotFound,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(
+				t,
+				testCase.retryable,
+				isRetryable(testCase.method, testCase.status, testCase.err),
+			)
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 10, 12, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name   string
+		header string
+		wait   time.Duration
+		ok     bool
+	}{
+		{
+			name: "absent",
+		},
+		{
+			name:   "seconds",
+			header: "7",
+			wait:   7 * time.Second,
+			ok:     true,
+		},
+		{
+			name:   "negative seconds",
+			header: "-1",
+		},
+		{
+			name:   "HTTP date",
+			header: now.Add(time.Minute).Format(http.TimeFormat),
+			wait:   time.Minute,
+			ok:     true,
+		},
+		{
+			name:   "HTTP date in the past",
+			header: now.Add(-time.Minute).Format(http.TimeFormat),
+			ok:     true,
+		},
+		{
+			name:   "garbage",
+			header: "soon",
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			wait, ok := parseRetryAfter(testCase.header, now)
+			require.Equal(t, testCase.ok, ok)
+			require.Equal(t, testCase.wait, wait)
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package gandi
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// secretCache serves Secrets from informers, sparing the API server a round
+// trip for every Secret lookup. Each informer watches a single Secret, selected
+// by name, so the webhook never holds any Secret it wasn't asked for, such as
+// TLS private keys, in memory. An informer for a Secret is started the first
+// time that Secret is requested and runs until the cache's stop channel is
+// closed. Since informers watch for changes, a rotated Secret takes effect as
+// soon as the change is observed and a deleted Secret is immediately
+// forgotten.
+type secretCache struct {
+	client kubernetes.Interface
+	stopCh <-chan struct{}
+
+	mu      sync.Mutex
+	secrets map[secretRef]*watchedSecret
+}
+
+// secretRef identifies a Secret.
+type secretRef struct {
+	namespace string
+	name      string
+}
+
+// watchedSecret is the informer and lister for a single Secret.
+type watchedSecret struct {
+	informer cache.SharedIndexInformer
+	lister   corelisters.SecretNamespaceLister
+}
+
+func newSecretCache(
+	client kubernetes.Interface,
+	stopCh <-chan struct{},
+) *secretCache {
+	return &secretCache{
+		client:  client,
+		stopCh:  stopCh,
+		secrets: map[secretRef]*watchedSecret{},
+	}
+}
+
+// get returns the named Secret from the given namespace. If the Secret's
+// informer has not yet synced, it blocks until it has or the given context is
+// done. The returned Secret is shared with the cache and must not be
+// modified.
+func (c *secretCache) get(
+	ctx context.Context,
+	namespace string,
+	name string,
+) (*corev1.Secret, error) {
+	secret := c.watch(secretRef{namespace: namespace, name: name})
+	if !cache.WaitForCacheSync(ctx.Done(), secret.informer.HasSynced) {
+		return nil, fmt.Errorf(
+			"timed out waiting for Secret %q in namespace %q to be cached: %w",
+			name, namespace, ctx.Err(),
+		)
+	}
+	return secret.lister.Get(name)
+}
+
+// watch returns the informer and lister for the given Secret, starting the
+// informer if necessary.
+func (c *secretCache) watch(ref secretRef) *watchedSecret {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if secret, ok := c.secrets[ref]; ok {
+		return secret
+	}
+	factory := informers.NewSharedInformerFactoryWithOptions(
+		c.client,
+		0, // Never resync; watching is enough to keep the cache current
+		informers.WithNamespace(ref.namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.FieldSelector = fields.OneTermEqualSelector("metadata.name", ref.name).String()
+		}),
+		informers.WithTransform(stripManagedFields),
+	)
+	secretInformer := factory.Core().V1().Secrets()
+	secret := &watchedSecret{
+		informer: secretInformer.Informer(),
+		lister:   secretInformer.Lister().Secrets(ref.namespace),
+	}
+	factory.Start(c.stopCh)
+	c.secrets[ref] = secret
+	return secret
+}
@@ -0,0 +1,140 @@
+package gandi
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestSecretCache(t *testing.T) {
+	client := fake.NewClientset(
+		newTestSecret(testNamespace, "token-a"),
+		newTestSecret("other-namespace", "token-b"),
+	)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	c := newSecretCache(client, stopCh)
+	ctx := context.Background()
+
+	secret, err := c.get(ctx, testNamespace, testSecretName)
+	require.NoError(t, err)
+	require.Equal(t, "token-a", string(secret.Data[testSecretKey]))
+
+	// Secrets are watched independently of one another
+	secret, err = c.get(ctx, "other-namespace", testSecretName)
+	require.NoError(t, err)
+	require.Equal(t, "token-b", string(secret.Data[testSecretKey]))
+	require.Len(t, c.secrets, 2)
+
+	_, err = c.get(ctx, testNamespace, "nonexistent")
+	require.True(t, apierrors.IsNotFound(err))
+
+	// A rotated Secret should take effect without any further lookups
+	_, err = client.CoreV1().Secrets(testNamespace).Update(
+		ctx,
+		newTestSecret(testNamespace, "token-c"),
+		metav1.UpdateOptions{},
+	)
+	require.NoError(t, err)
+	require.Eventually(
+		t,
+		func() bool {
+			secret, err = c.get(ctx, testNamespace, testSecretName)
+			return err == nil && string(secret.Data[testSecretKey]) == "token-c"
+		},
+		5*time.Second,
+		10*time.Millisecond,
+	)
+
+	// A deleted Secret should be forgotten
+	require.NoError(
+		t,
+		client.CoreV1().Secrets(testNamespace).Delete(
+			ctx,
+			testSecretName,
+			metav1.DeleteOptions{},
+		),
+	)
+	require.Eventually(
+		t,
+		func() bool {
+			_, err = c.get(ctx, testNamespace, testSecretName)
+			return apierrors.IsNotFound(err)
+		},
+		5*time.Second,
+		10*time.Millisecond,
+	)
+
+	// Each Secret should only ever have been read by listing and watching it
+	// by name. Other actions are the test's own.
+	for _, action := range client.Actions() {
+		if action.GetResource().Resource != "secrets" {
+			continue
+		}
+		require.NotEqual(t, "get", action.GetVerb())
+		var selector fields.Selector
+		switch a := action.(type) {
+		case clienttesting.ListAction:
+			selector = a.GetListRestrictions().Fields
+		case clienttesting.WatchAction:
+			selector = a.GetWatchRestrictions().Fields
+		default:
+			continue
+		}
+		_, named := selector.RequiresExactMatch("metadata.name")
+		require.True(t, named)
+	}
+}
+
+func TestSecretCacheNotSynced(t *testing.T) {
+	// An informer that is never started never syncs
+	stopCh := make(chan struct{})
+	close(stopCh)
+	c := newSecretCache(fake.NewClientset(), stopCh)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := c.get(ctx, testNamespace, testSecretName)
+	require.ErrorContains(t, err, "timed out waiting for Secret")
+}
+
+func TestSolverUsesSecretCache(t *testing.T) {
+	f := newFakeLiveDNS(t)
+	s := newTestSolver(t)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	require.NoError(t, s.Initialize(nil, stopCh))
+	require.NotNil(t, s.secrets)
+	runChallengeSteps(t, s, f, []challengeStep{present("key1"), cleanUp("key1")})
+	var lists int
+	for _, action := range s.client.(*fake.Clientset).Actions() { // nolint: forcetypeassert
+		// Secrets should never have been fetched individually, and should only
+		// have been listed once, when the Secret was first requested
+		if action.GetResource().Resource == "secrets" {
+			require.NotEqual(t, "get", action.GetVerb())
+			if action.GetVerb() == "list" {
+				lists++
+			}
+		}
+	}
+	require.Equal(t, 1, lists)
+}
+
+func newTestSecret(namespace, token string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      testSecretName,
+		},
+		Data: map[string][]byte{
+			testSecretKey: []byte(token),
+		},
+	}
+}
@@ -2,35 +2,133 @@ package gandi
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"os"
 	"slices"
 	"strings"
-	"sync"
+	"time"
 
 	"github.com/cert-manager/cert-manager/pkg/acme/webhook"
 	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
-	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	cmclient "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+
+	"github.com/krancovia/cert-manager-webhook-gandi/pkg/livedns"
 )
 
+// challengeTimeout bounds the total time spent presenting or cleaning up a
+// single challenge, including time spent waiting for a zone lock.
+const challengeTimeout = time.Minute
+
+// defaultClusterResourceNamespace is the namespace in which cert-manager looks
+// for resources referenced by ClusterIssuers unless configured otherwise.
+const defaultClusterResourceNamespace = "cert-manager"
+
 // solver is an implementation of the webhook.Solver interface that solves ACME
 // DNS-01 challenges using the Gandi LiveDNS API.
 type solver struct {
-	client    kubernetes.Interface
-	zoneMusMu sync.Mutex
-	zoneMus   map[string]*sync.Mutex
+	// ctx is the root context for all work performed by the solver. It is
+	// canceled when the stop channel passed to Initialize is closed.
+	ctx    context.Context
+	client kubernetes.Interface
+	// challenges is a client for cert-manager's resources. challengeCache is
+	// derived from it by Initialize and is used to find the Challenges to
+	// which Events are attached and those that own challenge record values.
+	challenges     cmclient.Interface
+	challengeCache *challengeCache
+	events         *challengeEvents
+	secrets        *secretCache
+	tokenFiles     *tokenFileCache
+	clients        *clientPool
+	zoneLocks      *zoneLockManager
+	// leaseLocking, if non-nil, enables locking zones across replicas using
+	// Leases. leaseLocks is derived from it by Initialize.
+	leaseLocking *LeaseLockingOptions
+	leaseLocks   *leaseZoneLocker
+	// gcOptions, if non-nil, enables garbage collection of orphaned challenge
+	// record values. gc is derived from it by Initialize.
+	gcOptions *GarbageCollectionOptions
+	gc        *garbageCollector
+	// metricsRegisterer, if non-nil, enables metrics. metrics is derived from
+	// it by Initialize.
+	metricsRegisterer prometheus.Registerer
+	metrics           *metrics
+	// clusterResourceNamespace is cert-manager's cluster resource namespace.
+	// Challenges for ClusterIssuers, and only those, carry it as their resource
+	// namespace.
+	clusterResourceNamespace string
+	// groupName is the API group under which the webhook serves the solver.
+	// Together with the solver's name, it identifies the Challenges the
+	// solver solves.
+	groupName string
+	logger    *slog.Logger
+}
+
+// SolverOption is a function that configures optional behavior of the solver
+// returned by NewSolver.
+type SolverOption func(*solver)
+
+// WithLeaseLocking returns a SolverOption that makes the solver lock zones
+// across all replicas of the webhook using coordination.k8s.io/v1 Leases
+// instead of only within its own process.
+func WithLeaseLocking(opts LeaseLockingOptions) SolverOption {
+	return func(s *solver) {
+		s.leaseLocking = &opts
+	}
+}
+
+// WithClusterResourceNamespace returns a SolverOption that informs the solver
+// of cert-manager's cluster resource namespace, if it differs from the
+// default. The solver relies on it to recognize challenges for ClusterIssuers,
+// which alone may reference Secrets in other namespaces.
+func WithClusterResourceNamespace(namespace string) SolverOption {
+	return func(s *solver) {
+		s.clusterResourceNamespace = namespace
+	}
+}
+
+// WithGroupName returns a SolverOption that informs the solver of the API
+// group under which the webhook serves it. The solver relies on it to tell the
+// Challenges it solves apart from those solved by other webhooks with the same
+// solver name. Without it, the garbage collector only considers zones in which
+// the solver has presented challenges since it started.
+func WithGroupName(groupName string) SolverOption {
+	return func(s *solver) {
+		s.groupName = groupName
+	}
+}
+
+// WithLogger returns a SolverOption that makes the solver log using the given
+// logger instead of the default one.
+func WithLogger(logger *slog.Logger) SolverOption {
+	return func(s *solver) {
+		s.logger = logger
+	}
 }
 
 // NewSolver returns an implementation of the webhook.Solver interface that
 // solves ACME DNS-01 challenges using the Gandi LiveDNS API.
-func NewSolver() webhook.Solver {
-	return &solver{
-		zoneMus: map[string]*sync.Mutex{},
+func NewSolver(opts ...SolverOption) webhook.Solver {
+	s := &solver{
+		ctx:                      context.Background(),
+		tokenFiles:               newTokenFileCache(),
+		zoneLocks:                newZoneLockManager(),
+		clusterResourceNamespace: defaultClusterResourceNamespace,
+		logger:                   slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	s.clients = newClientPool(s.logger)
+	return s
 }
 
 // Name implements the webhook.Solver interface.
@@ -39,92 +137,247 @@ func (s *solver) Name() string {
 }
 
 // Initialize implements the webhook.Solver interface.
-func (s *solver) Initialize(restCfg *rest.Config, _ <-chan struct{}) error {
+func (s *solver) Initialize(restCfg *rest.Config, stopCh <-chan struct{}) error {
+	// Derive a root context that is canceled when the stop channel is closed so
+	// that any in-flight LiveDNS API calls are aborted when the webhook server
+	// shuts down.
+	if stopCh != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.ctx = ctx
+		go func() {
+			<-stopCh
+			cancel()
+		}()
+	}
 	// By not setting this here if it's already been set, we allow for the
 	// possibility of injecting a fake clientset for testing purposes while still
 	// allowing a client to be constructed from the provided rest.Config
 	// otherwise.
-	if s.client != nil {
-		return nil
+	if s.client == nil {
+		cl, err := kubernetes.NewForConfig(restCfg)
+		if err != nil {
+			return fmt.Errorf("unable to get k8s client: %v", err)
+		}
+		s.client = cl
 	}
-	cl, err := kubernetes.NewForConfig(restCfg)
-	if err != nil {
-		return fmt.Errorf("unable to get k8s client: %v", err)
+	if s.challenges == nil {
+		cl, err := cmclient.NewForConfig(restCfg)
+		if err != nil {
+			return fmt.Errorf("unable to get cert-manager client: %v", err)
+		}
+		s.challenges = cl
+	}
+	s.challengeCache = newChallengeCache(s.challenges, s.ctx.Done())
+	s.events = newChallengeEvents(s.ctx, s.client, s.challengeCache, s.isClusterScoped)
+	s.secrets = newSecretCache(s.client, s.ctx.Done())
+	if s.leaseLocking != nil {
+		if s.leaseLocking.Namespace == "" || s.leaseLocking.Identity == "" {
+			return errors.New(
+				"lease locking requires both a namespace and an identity",
+			)
+		}
+		if d := s.leaseLocking.LeaseDuration; d != 0 && d <= challengeTimeout {
+			return fmt.Errorf(
+				"lease duration %s must exceed the challenge timeout of %s",
+				d, challengeTimeout,
+			)
+		}
+		s.leaseLocks = newLeaseZoneLocker(s.zoneLocks, s.client, *s.leaseLocking, s.logger)
+	}
+	if s.metricsRegisterer != nil {
+		m, err := newMetrics(s.metricsRegisterer, s.zoneLocks)
+		if err != nil {
+			return err
+		}
+		s.metrics = m
+	}
+	if s.gcOptions != nil {
+		s.gc = newGarbageCollector(s, *s.gcOptions)
+		go s.gc.run(s.ctx)
 	}
-	s.client = cl
 	return nil
 }
 
 // Present implements the webhook.Solver interface.
 func (s *solver) Present(cr *v1alpha1.ChallengeRequest) error {
-	cl, err := s.getClient(*cr)
+	return s.handle(*cr, actionPresent, reasonPresentFailed, s.present)
+}
+
+// handle performs the given action on the challenge described by the given
+// ChallengeRequest using the given function. It logs the outcome and, if the
+// action fails, records an Event with the given reason unless the failure is
+// better explained by a LiveDNS API error.
+func (s *solver) handle(
+	cr v1alpha1.ChallengeRequest,
+	action string,
+	failureReason string,
+	fn func(context.Context, v1alpha1.ChallengeRequest) error,
+) error {
+	ctx, cancel := context.WithTimeout(s.ctx, challengeTimeout)
+	defer cancel()
+	zone, entry := s.getZoneAndEntry(cr)
+	log := newChallengeLog(s.logger, cr, action, zone, entry)
+	ctx = withChallengeLog(ctx, log)
+	ctx, span := startSpan(
+		ctx,
+		"solver."+action,
+		append(
+			recordAttributes(zone, entry),
+			attribute.String("cert-manager.challenge.uid", string(cr.UID)),
+			attribute.String("cert-manager.challenge.dns_name", cr.DNSName),
+		)...,
+	)
+	observe := s.metrics.startChallenge(action)
+	err := fn(ctx, cr)
+	observe(err)
+	endSpan(span, err)
 	if err != nil {
-		err = fmt.Errorf("error getting Gandi LiveDNS API client: %w", err)
-		log.Println(err.Error())
+		log.logger().Error("challenge action failed", "durationMs", log.elapsedMs(), "error", err)
+		// The challenge's own context may have expired, so Events are recorded
+		// using one that isn't canceled along with it.
+		s.events.recordFailure(context.WithoutCancel(ctx), cr, failureReason, err)
 		return err
 	}
-	zone, entry := s.getZoneAndEntry(*cr)
-	s.getZoneLock(zone)
-	defer s.releaseZoneLock(zone)
-	values, err := cl.getTxtRecordValues(zone, entry)
+	log.logger().Info("challenge action succeeded", "durationMs", log.elapsedMs())
+	return nil
+}
+
+func (s *solver) present(ctx context.Context, cr v1alpha1.ChallengeRequest) error {
+	cfg, err := loadConfig(cr)
 	if err != nil {
-		err = fmt.Errorf("error checking for existence of TXT record: %w", err)
-		log.Println(err.Error())
 		return err
 	}
-	if len(values) == 0 {
-		if err = cl.createTxtRecord(zone, entry, []string{cr.Key}); err != nil {
-			err = fmt.Errorf("error creating TXT record: %w", err)
-			log.Println(err.Error())
-			return err
-		}
-		return nil
+	zone, entry, err := s.resolveZoneAndEntry(ctx, cr, cfg)
+	if err != nil {
+		return fmt.Errorf("error resolving challenge record name: %w", err)
+	}
+	setChallengeRecord(ctx, zone, entry)
+	cl, err := s.getClient(ctx, cr.ResourceNamespace, zone, cfg)
+	if err != nil {
+		return fmt.Errorf("error getting Gandi LiveDNS API client: %w", err)
 	}
-	values = append(values, cr.Key)
-	if err = cl.updateTxtRecord(zone, entry, values); err != nil {
-		err = fmt.Errorf("error updating TXT record: %w", err)
-		log.Println(err.Error())
+	change, err := s.addKey(ctx, cl, zone, entry, cr.Key, cfg.TTL)
+	if err != nil {
 		return err
 	}
+	s.gc.track(zone, entry, cr.ResourceNamespace, cfg)
+	s.events.recordChange(ctx, cr, change, zone, entry)
+	if cfg.Propagation != nil {
+		return s.waitForPropagation(ctx, *cfg.Propagation, zone, entry, cr.Key, true)
+	}
 	return nil
 }
 
+// addKey adds the given key to the TXT record set with the given name in the
+// given zone, creating the record set with the given TTL if it doesn't already
+// exist. It returns the change made to the record set.
+func (s *solver) addKey(
+	ctx context.Context,
+	cl *client,
+	zone string,
+	entry string,
+	key string,
+	ttl int,
+) (recordSetChange, error) {
+	releaseZoneLock, err := s.lockZone(ctx, zone)
+	if err != nil {
+		return recordUnchanged, err
+	}
+	defer releaseZoneLock()
+	rrs, err := cl.getTxtRecord(ctx, zone, entry)
+	if err != nil {
+		return recordUnchanged, fmt.Errorf("error checking for existence of TXT record: %w", explainAPIError(err, zone))
+	}
+	if rrs == nil || len(rrs.Values) == 0 {
+		if err = cl.createTxtRecord(ctx, zone, entry, ttl, []string{key}); err != nil {
+			return recordUnchanged, fmt.Errorf("error creating TXT record: %w", explainAPIError(err, zone))
+		}
+		return recordCreated, nil
+	}
+	// cert-manager routinely retries Present, so the key may already be there.
+	// Values returned by the client are already unquoted, so the key must be
+	// normalized in the same way before comparing.
+	if slices.Contains(rrs.Values, livedns.UnquoteTXT(key)) {
+		return recordUnchanged, nil
+	}
+	// Add our key to the existing record set without disturbing its TTL, which
+	// may have been chosen by someone else.
+	values := append(rrs.Values, key)
+	if err = cl.updateTxtRecord(ctx, zone, entry, rrs.TTL, values); err != nil {
+		return recordUnchanged, fmt.Errorf("error updating TXT record: %w", explainAPIError(err, zone))
+	}
+	return recordUpdated, nil
+}
+
 // CleanUp implements the webhook.Solver interface.
 func (s *solver) CleanUp(cr *v1alpha1.ChallengeRequest) error {
-	cl, err := s.getClient(*cr)
+	return s.handle(*cr, actionCleanUp, reasonCleanUpFailed, s.cleanUp)
+}
+
+func (s *solver) cleanUp(ctx context.Context, cr v1alpha1.ChallengeRequest) error {
+	cfg, err := loadConfig(cr)
 	if err != nil {
-		err = fmt.Errorf("error getting Gandi LiveDNS API client: %w", err)
-		log.Println(err.Error())
 		return err
 	}
-	zone, entry := s.getZoneAndEntry(*cr)
-	s.getZoneLock(zone)
-	defer s.releaseZoneLock(zone)
-	values, err := cl.getTxtRecordValues(zone, entry)
+	zone, entry, err := s.resolveZoneAndEntry(ctx, cr, cfg)
+	if err != nil {
+		return fmt.Errorf("error resolving challenge record name: %w", err)
+	}
+	setChallengeRecord(ctx, zone, entry)
+	cl, err := s.getClient(ctx, cr.ResourceNamespace, zone, cfg)
+	if err != nil {
+		return fmt.Errorf("error getting Gandi LiveDNS API client: %w", err)
+	}
+	change, err := s.removeKey(ctx, cl, zone, entry, cr.Key)
 	if err != nil {
-		err = fmt.Errorf("error checking for existence of TXT record: %w", err)
-		log.Println(err.Error())
 		return err
 	}
-	if len(values) == 0 {
-		return nil
+	s.events.recordChange(ctx, cr, change, zone, entry)
+	if cfg.Propagation != nil {
+		return s.waitForPropagation(ctx, *cfg.Propagation, zone, entry, cr.Key, false)
 	}
-	if len(values) == 1 {
-		if err = cl.deleteTxtRecord(zone, entry); err != nil {
-			err = fmt.Errorf("error deleting TXT record: %w", err)
-			log.Println(err.Error())
-			return err
-		}
+	return nil
+}
+
+// removeKey removes the given key, and only the given key, from the TXT record
+// set with the given name in the given zone, deleting the record set if no
+// other values remain. It returns the change made to the record set.
+func (s *solver) removeKey(
+	ctx context.Context,
+	cl *client,
+	zone string,
+	entry string,
+	key string,
+) (recordSetChange, error) {
+	releaseZoneLock, err := s.lockZone(ctx, zone)
+	if err != nil {
+		return recordUnchanged, err
+	}
+	defer releaseZoneLock()
+	rrs, err := cl.getTxtRecord(ctx, zone, entry)
+	if err != nil {
+		return recordUnchanged, fmt.Errorf("error checking for existence of TXT record: %w", explainAPIError(err, zone))
+	}
+	key = livedns.UnquoteTXT(key)
+	if rrs == nil || !slices.Contains(rrs.Values, key) {
+		// There's nothing of ours to clean up
+		return recordUnchanged, nil
 	}
-	values = slices.DeleteFunc(values, func(val string) bool {
-		return val == cr.Key
+	// Remove our key, and only our key, leaving any other values alone
+	values := slices.DeleteFunc(slices.Clone(rrs.Values), func(val string) bool {
+		return val == key
 	})
-	if err = cl.updateTxtRecord(zone, entry, values); err != nil {
-		err = fmt.Errorf("error updating TXT record: %w", err)
-		log.Println(err.Error())
-		return err
+	if len(values) == 0 {
+		// Our key was the only value, so the whole record set can go
+		if err = cl.deleteTxtRecord(ctx, zone, entry); err != nil && !livedns.IsNotFound(err) {
+			return recordUnchanged, fmt.Errorf("error deleting TXT record: %w", explainAPIError(err, zone))
+		}
+		return recordDeleted, nil
 	}
-	return nil
+	if err = cl.updateTxtRecord(ctx, zone, entry, rrs.TTL, values); err != nil {
+		return recordUnchanged, fmt.Errorf("error updating TXT record: %w", explainAPIError(err, zone))
+	}
+	return recordUpdated, nil
 }
 
 // TODO: Add tests
@@ -135,71 +388,241 @@ func (s *solver) getZoneAndEntry(cr v1alpha1.ChallengeRequest) (string, string)
 	return strings.TrimSuffix(cr.ResolvedZone, "."), strings.TrimSuffix(entry, ".")
 }
 
-// getClient returns a new Gandi LiveDNS API client.
-func (s *solver) getClient(cr v1alpha1.ChallengeRequest) (*client, error) {
-	accessToken, err := s.getAccessToken(cr)
+// resolveZoneAndEntry returns the zone and entry into which the challenge
+// record for the given ChallengeRequest should be written. Unless following
+// CNAMEs is enabled, these are the ones resolved by cert-manager. Otherwise,
+// they are derived from the name at the end of any chain of CNAME records
+// starting at the challenge name.
+func (s *solver) resolveZoneAndEntry(
+	ctx context.Context,
+	cr v1alpha1.ChallengeRequest,
+	cfg Config,
+) (string, string, error) {
+	if cfg.CNAME == nil {
+		zone, entry := s.getZoneAndEntry(cr)
+		return zone, entry, nil
+	}
+	var lookup cnameLookup
+	switch cfg.CNAME.Resolver {
+	case CNAMEResolverAPI:
+		lookup = &apiCNAMELookup{
+			clientFor: func(ctx context.Context, zone string) (*client, error) {
+				return s.getClient(ctx, cr.ResourceNamespace, zone, cfg)
+			},
+		}
+	default:
+		dnsLookup, err := newDNSCNAMELookup(cfg.CNAME.Nameservers)
+		if err != nil {
+			return "", "", err
+		}
+		lookup = dnsLookup
+	}
+	target, err := followCNAMEs(ctx, lookup, cr.ResolvedFQDN, cfg.CNAME.MaxDepth)
+	if err != nil {
+		return "", "", err
+	}
+	if target == normalizeFQDN(cr.ResolvedFQDN) {
+		// There was no CNAME to follow
+		zone, entry := s.getZoneAndEntry(cr)
+		return zone, entry, nil
+	}
+	zone, err := lookup.findZone(ctx, target)
+	if err != nil {
+		return "", "", fmt.Errorf("error finding zone hosting %q: %w", target, err)
+	}
+	log := challengeLogFrom(ctx)
+	log.logger().Info(
+		"following CNAME",
+		"from", cr.ResolvedFQDN,
+		"to", target,
+		"targetZone", zone,
+		"durationMs", log.elapsedMs(),
+	)
+	return zone, relativeName(target, zone), nil
+}
+
+// setChallengeRecord records the zone and entry into which the challenge record
+// is written in the logger and span carried by the given context.
+func setChallengeRecord(ctx context.Context, zone string, entry string) {
+	challengeLogFrom(ctx).setRecord(zone, entry)
+	trace.SpanFromContext(ctx).SetAttributes(recordAttributes(zone, entry)...)
+}
+
+// getClient returns a pooled Gandi LiveDNS API client authenticated by the
+// credential configured for the given zone.
+func (s *solver) getClient(
+	ctx context.Context,
+	resourceNamespace string,
+	zone string,
+	cfg Config,
+) (*client, error) {
+	cfg, err := cfg.forZone(zone)
 	if err != nil {
 		return nil, err
 	}
-	return newClient(accessToken), nil
+	accessToken, err := s.getAccessToken(ctx, resourceNamespace, cfg)
+	if err != nil {
+		return nil, err
+	}
+	cl := s.clients.get(credentialSourceID(resourceNamespace, cfg.CredentialSource), cfg, accessToken)
+	cl.metrics = s.metrics
+	return cl, nil
 }
 
-// getAccessToken gets a PAT for the Gandi LiveDNS from a Kubernetes Secret.
-//
-// TODO: Add tests
-func (s *solver) getAccessToken(cr v1alpha1.ChallengeRequest) (string, error) {
-	cfg := struct {
-		APIKeySecretRef cmmeta.SecretKeySelector `json:"apiKeySecretRef"`
-	}{}
-	if err := json.Unmarshal(cr.Config.Raw, &cfg); err != nil {
-		return "", fmt.Errorf("error decoding solver config: %w", err)
-	}
-	secretName := cfg.APIKeySecretRef.LocalObjectReference.Name
-	secret, err := s.client.CoreV1().Secrets(cr.ResourceNamespace).Get(
-		context.Background(),
-		secretName,
-		metav1.GetOptions{},
-	)
+// getAccessToken gets the credential for the Gandi LiveDNS API from whichever
+// source the given configuration specifies. Sources local to the webhook's own
+// Pod are available only to ClusterIssuers. Otherwise, the author of any
+// Issuer could read arbitrary files or environment variables of the webhook
+// and direct them to an API endpoint of their choosing.
+func (s *solver) getAccessToken(
+	ctx context.Context,
+	resourceNamespace string,
+	cfg Config,
+) (_ string, err error) {
+	ctx, span := startSpan(ctx, "getAccessToken", credentialSourceAttribute.String(cfg.sourceName()))
+	defer func() { endSpan(span, err) }()
+	switch {
+	case cfg.APIKeyFile != "":
+		if !s.isClusterScoped(resourceNamespace) {
+			return "", fmt.Errorf(
+				"apiKeyFile is not permitted for an Issuer in namespace %q; only "+
+					"ClusterIssuers may read credentials from files",
+				resourceNamespace,
+			)
+		}
+		return s.tokenFiles.get(cfg.APIKeyFile)
+	case cfg.APIKeyEnv != "":
+		if !s.isClusterScoped(resourceNamespace) {
+			return "", fmt.Errorf(
+				"apiKeyEnv is not permitted for an Issuer in namespace %q; only "+
+					"ClusterIssuers may read credentials from environment variables",
+				resourceNamespace,
+			)
+		}
+		apiKey := strings.TrimSpace(os.Getenv(cfg.APIKeyEnv))
+		if apiKey == "" {
+			return "", fmt.Errorf("environment variable %q is not set", cfg.APIKeyEnv)
+		}
+		return apiKey, nil
+	}
+	return s.getAccessTokenFromSecret(ctx, resourceNamespace, *cfg.APIKeySecretRef)
+}
+
+// getAccessTokenFromSecret gets the credential for the Gandi LiveDNS API from
+// the Kubernetes Secret referenced by the given selector.
+func (s *solver) getAccessTokenFromSecret(
+	ctx context.Context,
+	resourceNamespace string,
+	ref SecretKeySelector,
+) (string, error) {
+	namespace, err := s.getSecretNamespace(resourceNamespace, ref)
+	if err != nil {
+		return "", err
+	}
+	secret, err := s.getSecret(ctx, namespace, ref.Name)
 	if err != nil {
 		return "", fmt.Errorf(
 			"error getting Secret %q in namespace %q: %w",
-			secretName, cr.ResourceNamespace, err,
+			ref.Name, namespace, err,
 		)
 	}
-	apiKey := string(secret.Data[cfg.APIKeySecretRef.Key])
+	apiKey := string(secret.Data[ref.Key])
 	if apiKey == "" {
 		return "", fmt.Errorf(
 			"key %q not found in secret \"%s/%s\"",
-			cfg.APIKeySecretRef.Key, secretName, cr.ResourceNamespace)
+			ref.Key, namespace, ref.Name)
 	}
 	return apiKey, nil
 }
 
-func (s *solver) getZoneLock(zone string) {
-	// Look for a zone-specific mutex
-	if zoneMu, exists := s.zoneMus[zone]; exists {
-		// It exists, so lock it and return
-		zoneMu.Lock()
-		return
+// getSecretNamespace returns the namespace of the Secret referenced by the
+// given selector for a challenge with the given resource namespace. Only
+// ClusterIssuers may reference a Secret in another namespace.
+func (s *solver) getSecretNamespace(
+	resourceNamespace string,
+	ref SecretKeySelector,
+) (string, error) {
+	namespace := ref.Namespace
+	if namespace == "" || namespace == resourceNamespace {
+		return resourceNamespace, nil
+	}
+	if !s.isClusterScoped(resourceNamespace) {
+		return "", fmt.Errorf(
+			"apiKeySecretRef.namespace %q is not permitted for an Issuer in "+
+				"namespace %q; only ClusterIssuers may reference Secrets in "+
+				"other namespaces",
+			namespace, resourceNamespace,
+		)
+	}
+	return namespace, nil
+}
+
+// isClusterScoped returns true if a challenge with the given resource
+// namespace was issued by a ClusterIssuer, whose challenges carry
+// cert-manager's cluster resource namespace. Note that an Issuer in the
+// cluster resource namespace itself is indistinguishable from a ClusterIssuer
+// and is granted the same privileges.
+func (s *solver) isClusterScoped(resourceNamespace string) bool {
+	return resourceNamespace == s.clusterResourceNamespace
+}
+
+// getSecret returns the named Secret from the given namespace. Secrets are
+// served from the solver's cache once Initialize has been called and fetched
+// directly from the API server otherwise.
+func (s *solver) getSecret(
+	ctx context.Context,
+	namespace string,
+	name string,
+) (*corev1.Secret, error) {
+	if s.secrets != nil {
+		return s.secrets.get(ctx, namespace, name)
 	}
-	// The zone-specific mutex doesn't exist, so create it. This requires first
-	// locking the the master mutex to ensure that only one goroutine is creating
-	// the zone-specific mutex.
-	s.zoneMusMu.Lock()
-	defer s.zoneMusMu.Unlock()
-	// Double-check that the zone-specific mutex doesn't exist in case another
-	// goroutine created it while we were waiting for a lock on the master mutex.
-	if zoneLock, exists := s.zoneMus[zone]; exists {
-		zoneLock.Lock()
-		return
+	return s.client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+// lockZone blocks until the given zone has been locked, using Leases if they
+// are enabled, or until the given context is done. On success, it returns a
+// function that releases the lock. The time spent waiting is measured either
+// way.
+func (s *solver) lockZone(ctx context.Context, zone string) (_ func(), err error) {
+	ctx, span := startSpan(ctx, "lockZone", zoneAttribute.String(zone))
+	start := time.Now()
+	defer func() {
+		s.metrics.observeZoneLockWait(time.Since(start), err)
+		endSpan(span, err)
+	}()
+	if s.leaseLocks != nil {
+		return s.leaseLocks.acquire(ctx, zone)
 	}
-	// The zone-specific mutex doesn't exist, so create it and lock it.
-	s.zoneMus[zone] = &sync.Mutex{}
-	s.zoneMus[zone].Lock()
+	return s.zoneLocks.acquire(ctx, zone)
 }
 
-func (s *solver) releaseZoneLock(zone string) {
-	if zoneMu, exists := s.zoneMus[zone]; exists {
-		zoneMu.Unlock()
+// explainAPIError annotates errors returned by the LiveDNS API with the most
+// likely reason Gandi refused a request pertaining to the given zone. Errors
+// that aren't understood are returned unchanged.
+func explainAPIError(err error, zone string) error {
+	switch {
+	case livedns.IsUnauthorized(err):
+		return fmt.Errorf(
+			"token was rejected by Gandi; it may be invalid, expired, or of "+
+				"the wrong kind: %w",
+			err,
+		)
+	case livedns.IsForbidden(err):
+		return fmt.Errorf("token lacks LiveDNS permission on domain %q: %w", zone, err)
+	case livedns.IsNotFound(err):
+		return fmt.Errorf(
+			"domain %q is not managed by Gandi LiveDNS or is not visible to this "+
+				"token: %w",
+			zone, err,
+		)
+	case livedns.IsRateLimited(err):
+		return fmt.Errorf("rate limited by Gandi while managing domain %q: %w", zone, err)
+	case livedns.IsConflict(err):
+		return fmt.Errorf(
+			"TXT record in domain %q was modified concurrently: %w",
+			zone, err,
+		)
 	}
+	return err
 }
@@ -1,224 +1,777 @@
-//go:build integration
-// +build integration
-
 package gandi
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"math/rand"
+	"log/slog"
+	"net/http"
 	"os"
-	"strings"
+	"path/filepath"
+	"sync"
 	"testing"
-	"time"
 
-	whapi "github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
-	"github.com/cert-manager/cert-manager/pkg/issuer/acme/dns/util"
-	"github.com/miekg/dns"
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	cmfake "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/fake"
 	"github.com/stretchr/testify/require"
-	corev1 "k8s.io/api/core/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/krancovia/cert-manager-webhook-gandi/pkg/livedns"
 )
 
-func TestSolver(t *testing.T) {
-	testNameServer := os.Getenv("TEST_NAME_SERVER")
-	if testNameServer == "" {
-		// Using one of Gandi's own DNS servers seems like a sensible default for
-		// minimizing the time spent waiting for records and record deletions to
-		// propagate.
-		//
-		// As of 2024-10-12, any of the following should work:
-		//
-		// TODO: Do we really need to include port numbers?
-		testNameServer = "ns-22-a.gandi.net:53"
-		// testNameServer = "ns-138-b.gandi.net:53"
-		// testNameServer = "ns-146-c.gandi.net:53"
-	}
-
-	// Must be a zone that is managed by Gandi DNS
-	testZone := os.Getenv("TEST_ZONE")
-	require.NotEmpty(t, testZone, "env var TEST_ZONE must be set")
-	require.True(t, strings.HasSuffix(testZone, "."))
-
-	testFQDN := fmt.Sprintf("cert-manager-dns01-tests.%s", testZone)
-
-	// The DNS name for which we are simulating a challenge. MUST be within the
-	// zone specified by testZone.
-	testDNSName := os.Getenv("TEST_DNS_NAME")
-	require.NotEmpty(t, testDNSName, "env var TEST_DNS_NAME must be set")
-	require.True(
-		t,
-		strings.HasSuffix(
-			testDNSName,
-			strings.TrimSuffix(testZone, "."),
-		),
-	)
+const (
+	testNamespace  = "cert-manager"
+	testSecretName = "gandi-access-token"
+	testSecretKey  = "token"
+)
+
+// challengeStep is a single call to Present or CleanUp made by a test.
+type challengeStep struct {
+	cleanUp bool
+	key     string
+}
 
-	testGandiPAT := os.Getenv("GANDI_PAT")
-	require.NotEmpty(t, testGandiPAT, "env var GANDI_PAT must be set")
+func present(key string) challengeStep {
+	return challengeStep{key: key}
+}
 
-	const testAccessTokenSecretNamespace = "cert-manager"
-	const testAccessTokenSecretName = "gandi-access-token"
-	const testAccessTokenSecretKey = "token"
+func cleanUp(key string) challengeStep {
+	return challengeStep{cleanUp: true, key: key}
+}
 
-	testJSONConfig := &apiextensionsv1.JSON{}
-	var err error
-	testJSONConfig.Raw, err = json.Marshal(map[string]any{
-		"apiKeySecretRef": map[string]any{
-			"name": testAccessTokenSecretName,
-			"key":  testAccessTokenSecretKey,
+func TestSolverPresent(t *testing.T) {
+	testCases := []struct {
+		name       string
+		existing   *livedns.RRSet
+		steps      []challengeStep
+		assertions func(*testing.T, *fakeLiveDNS)
+	}{
+		{
+			name:  "creates a new record",
+			steps: []challengeStep{present("key1")},
+			assertions: func(t *testing.T, f *fakeLiveDNS) {
+				rrs := f.get(testZone, testEntryName, "TXT")
+				require.NotNil(t, rrs)
+				require.Equal(t, []string{`"key1"`}, rrs.Values)
+				require.Equal(t, minTTL, rrs.TTL)
+				require.Equal(t, 1, f.writeCount())
+			},
 		},
-	})
-	require.NoError(t, err)
+		{
+			name:  "repeated Present is a no-op",
+			steps: []challengeStep{present("key1"), present("key1"), present("key1")},
+			assertions: func(t *testing.T, f *fakeLiveDNS) {
+				rrs := f.get(testZone, testEntryName, "TXT")
+				require.Equal(t, []string{`"key1"`}, rrs.Values)
+				require.Equal(t, 1, f.writeCount())
+			},
+		},
+		{
+			name:  "concurrent challenges share a record",
+			steps: []challengeStep{present("key1"), present("key2"), present("key1"), present("key2")},
+			assertions: func(t *testing.T, f *fakeLiveDNS) {
+				rrs := f.get(testZone, testEntryName, "TXT")
+				require.Equal(t, []string{`"key1"`, `"key2"`}, rrs.Values)
+				require.Equal(t, 2, f.writeCount())
+			},
+		},
+		{
+			name: "appends to an existing record and keeps its TTL",
+			existing: &livedns.RRSet{
+				Type:   "TXT",
+				TTL:    3600,
+				Name:   testEntryName,
+				Values: []string{"unrelated"},
+			},
+			steps: []challengeStep{present("key1"), present("key1")},
+			assertions: func(t *testing.T, f *fakeLiveDNS) {
+				rrs := f.get(testZone, testEntryName, "TXT")
+				require.Equal(t, []string{`"unrelated"`, `"key1"`}, rrs.Values)
+				require.Equal(t, 3600, rrs.TTL)
+				require.Equal(t, 1, f.writeCount())
+			},
+		},
+		{
+			name: "key already present in quoted form",
+			existing: &livedns.RRSet{
+				Type:   "TXT",
+				TTL:    minTTL,
+				Name:   testEntryName,
+				Values: []string{`"key1"`},
+			},
+			steps: []challengeStep{present("key1")},
+			assertions: func(t *testing.T, f *fakeLiveDNS) {
+				rrs := f.get(testZone, testEntryName, "TXT")
+				require.Equal(t, []string{`"key1"`}, rrs.Values)
+				require.Zero(t, f.writeCount())
+			},
+		},
+		{
+			name: "Present after CleanUp of another key",
+			steps: []challengeStep{
+				present("key1"),
+				present("key2"),
+				cleanUp("key1"),
+				present("key2"),
+				present("key3"),
+			},
+			assertions: func(t *testing.T, f *fakeLiveDNS) {
+				rrs := f.get(testZone, testEntryName, "TXT")
+				require.Equal(t, []string{`"key2"`, `"key3"`}, rrs.Values)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			f := newFakeLiveDNS(t)
+			if testCase.existing != nil {
+				f.set(testZone, *testCase.existing)
+			}
+			s := newTestSolver(t)
+			runChallengeSteps(t, s, f, testCase.steps)
+			testCase.assertions(t, f)
+		})
+	}
+}
 
-	s := NewSolver()
-	solver, ok := s.(*solver)
-	require.True(t, ok)
-	solver.client = fake.NewClientset(
-		&corev1.Secret{
-			ObjectMeta: metav1.ObjectMeta{
-				Namespace: testAccessTokenSecretNamespace,
-				Name:      testAccessTokenSecretName,
+func TestSolverCleanUp(t *testing.T) {
+	testCases := []struct {
+		name       string
+		existing   *livedns.RRSet
+		steps      []challengeStep
+		assertions func(*testing.T, *fakeLiveDNS)
+	}{
+		{
+			name:  "no record",
+			steps: []challengeStep{cleanUp("key1")},
+			assertions: func(t *testing.T, f *fakeLiveDNS) {
+				require.Nil(t, f.get(testZone, testEntryName, "TXT"))
+				require.Zero(t, f.writeCount())
 			},
-			Data: map[string][]byte{
-				testAccessTokenSecretKey: []byte(testGandiPAT),
+		},
+		{
+			name: "record does not contain our key",
+			existing: &livedns.RRSet{
+				Type:   "TXT",
+				TTL:    3600,
+				Name:   testEntryName,
+				Values: []string{"unrelated"},
+			},
+			steps: []challengeStep{cleanUp("key1")},
+			assertions: func(t *testing.T, f *fakeLiveDNS) {
+				rrs := f.get(testZone, testEntryName, "TXT")
+				require.Equal(t, []string{`"unrelated"`}, rrs.Values)
+				require.Zero(t, f.writeCount())
 			},
 		},
-	)
+		{
+			name:  "our key is the only value",
+			steps: []challengeStep{present("key1"), cleanUp("key1")},
+			assertions: func(t *testing.T, f *fakeLiveDNS) {
+				require.Nil(t, f.get(testZone, testEntryName, "TXT"))
+				require.Equal(t, 2, f.writeCount())
+			},
+		},
+		{
+			name: "our key is the only value in quoted form",
+			existing: &livedns.RRSet{
+				Type:   "TXT",
+				TTL:    minTTL,
+				Name:   testEntryName,
+				Values: []string{`"key1"`},
+			},
+			steps: []challengeStep{cleanUp("key1")},
+			assertions: func(t *testing.T, f *fakeLiveDNS) {
+				require.Nil(t, f.get(testZone, testEntryName, "TXT"))
+				require.Equal(t, 1, f.writeCount())
+			},
+		},
+		{
+			name: "other values remain and keep their TTL",
+			existing: &livedns.RRSet{
+				Type:   "TXT",
+				TTL:    3600,
+				Name:   testEntryName,
+				Values: []string{"unrelated"},
+			},
+			steps: []challengeStep{present("key1"), cleanUp("key1")},
+			assertions: func(t *testing.T, f *fakeLiveDNS) {
+				rrs := f.get(testZone, testEntryName, "TXT")
+				require.Equal(t, []string{`"unrelated"`}, rrs.Values)
+				require.Equal(t, 3600, rrs.TTL)
+				require.Equal(t, 2, f.writeCount())
+			},
+		},
+		{
+			name: "removes duplicate copies of our key",
+			existing: &livedns.RRSet{
+				Type:   "TXT",
+				TTL:    minTTL,
+				Name:   testEntryName,
+				Values: []string{"key1", "key2", "key1"},
+			},
+			steps: []challengeStep{cleanUp("key1")},
+			assertions: func(t *testing.T, f *fakeLiveDNS) {
+				rrs := f.get(testZone, testEntryName, "TXT")
+				require.Equal(t, []string{`"key2"`}, rrs.Values)
+			},
+		},
+		{
+			name: "only the last remaining value is unrelated",
+			existing: &livedns.RRSet{
+				Type:   "TXT",
+				TTL:    minTTL,
+				Name:   testEntryName,
+				Values: []string{"unrelated"},
+			},
+			steps: []challengeStep{present("key1"), cleanUp("key1"), cleanUp("key1")},
+			assertions: func(t *testing.T, f *fakeLiveDNS) {
+				rrs := f.get(testZone, testEntryName, "TXT")
+				require.Equal(t, []string{`"unrelated"`}, rrs.Values)
+				require.Equal(t, 2, f.writeCount())
+			},
+		},
+		{
+			name: "interleaved challenges",
+			steps: []challengeStep{
+				present("key1"),
+				present("key2"),
+				cleanUp("key2"),
+				cleanUp("key2"),
+				present("key3"),
+				cleanUp("key1"),
+				cleanUp("key3"),
+				cleanUp("key3"),
+			},
+			assertions: func(t *testing.T, f *fakeLiveDNS) {
+				require.Nil(t, f.get(testZone, testEntryName, "TXT"))
+				require.Equal(t, 6, f.writeCount())
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			f := newFakeLiveDNS(t)
+			if testCase.existing != nil {
+				f.set(testZone, *testCase.existing)
+			}
+			s := newTestSolver(t)
+			runChallengeSteps(t, s, f, testCase.steps)
+			testCase.assertions(t, f)
+		})
+	}
+}
 
-	ch1 := &whapi.ChallengeRequest{
-		ResourceNamespace: testAccessTokenSecretNamespace,
-		ResolvedFQDN:      testFQDN,
-		ResolvedZone:      testZone,
-		Config:            testJSONConfig,
-		DNSName:           testDNSName,
-		Key:               randomString(),
-	}
-	t.Logf("Presenting first ChallengeRequest: %#v", ch1)
-	if err := solver.Present(ch1); err != nil {
-		t.Errorf("expected Present to not error, but got: %v", err)
-		return
-	}
-	defer func() {
-		if err := solver.CleanUp(ch1); err != nil {
-			t.Errorf("expected CleanUp to not error, but got: %v", err)
-		}
-	}()
-
-	ch2 := &whapi.ChallengeRequest{
-		ResourceNamespace: testAccessTokenSecretNamespace,
-		ResolvedFQDN:      testFQDN,
-		ResolvedZone:      testZone,
-		Config:            testJSONConfig,
-		DNSName:           testDNSName,
-		Key:               randomString(),
-	}
-	t.Logf("Presenting second ChallengeRequest: %#v", ch2)
-	if err := solver.Present(ch2); err != nil {
-		t.Errorf("expected Present to not error, but got: %v", err)
-		return
-	}
-	defer func() {
-		if err := solver.CleanUp(ch2); err != nil {
-			t.Errorf("expected CleanUp to not error, but got: %v", err)
-		}
-	}()
+func TestSolverCleanUpErrors(t *testing.T) {
+	testCases := []struct {
+		name       string
+		existing   []string
+		method     string
+		status     int
+		assertions func(*testing.T, *fakeLiveDNS, error)
+	}{
+		{
+			name:     "error getting record",
+			existing: []string{"key1"},
+			method:   http.MethodGet,
+			status:   http.StatusForbidden,
+			assertions: func(t *testing.T, f *fakeLiveDNS, err error) {
+				require.ErrorContains(t, err, "error checking for existence of TXT record")
+				require.ErrorContains(t, err, "token lacks LiveDNS permission")
+				require.True(t, livedns.IsForbidden(err))
+				require.NotNil(t, f.get(testZone, testEntryName, "TXT"))
+			},
+		},
+		{
+			name:     "error deleting record",
+			existing: []string{"key1"},
+			method:   http.MethodDelete,
+			status:   http.StatusInternalServerError,
+			assertions: func(t *testing.T, _ *fakeLiveDNS, err error) {
+				require.ErrorContains(t, err, "error deleting TXT record")
+			},
+		},
+		{
+			name:     "record deleted by someone else in the meantime",
+			existing: []string{"key1"},
+			method:   http.MethodDelete,
+			status:   http.StatusNotFound,
+			assertions: func(t *testing.T, _ *fakeLiveDNS, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:     "error updating record",
+			existing: []string{"key1", "unrelated"},
+			method:   http.MethodPut,
+			status:   http.StatusInternalServerError,
+			assertions: func(t *testing.T, f *fakeLiveDNS, err error) {
+				require.ErrorContains(t, err, "error updating TXT record")
+				rrs := f.get(testZone, testEntryName, "TXT")
+				require.Len(t, rrs.Values, 2)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			f := newFakeLiveDNS(t)
+			f.set(testZone, livedns.RRSet{
+				Type:   "TXT",
+				TTL:    minTTL,
+				Name:   testEntryName,
+				Values: testCase.existing,
+			})
+			f.failWith(testCase.method, testCase.status)
+			s := newTestSolver(t)
+			testCase.assertions(t, f, s.CleanUp(newTestChallengeRequest(t, f, "key1")))
+		})
+	}
+}
 
-	pollInterval := time.Second * 3
-	propagationLimit := time.Minute * 5
+func TestSolverConcurrentChallenges(t *testing.T) {
+	const challenges = 20
+	f := newFakeLiveDNS(t)
+	s := newTestSolver(t)
+	wg := sync.WaitGroup{}
+	for i := range challenges {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cr := newTestChallengeRequest(t, f, fmt.Sprintf("key%d", i))
+			if err := s.Present(cr); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	// Had any read-modify-write cycles overlapped, keys would have been lost
+	require.Len(t, f.get(testZone, testEntryName, "TXT").Values, challenges)
+	for i := range challenges {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cr := newTestChallengeRequest(t, f, fmt.Sprintf("key%d", i))
+			if err := s.CleanUp(cr); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	require.Nil(t, f.get(testZone, testEntryName, "TXT"))
+	require.Zero(t, s.zoneLocks.size())
+}
 
-	t.Log("Waiting for both records to propagate...")
-	if err := wait.PollUntilContextTimeout(
+func TestSolverLeaseLocking(t *testing.T) {
+	f := newFakeLiveDNS(t)
+	s := newTestSolver(t, WithLeaseLocking(LeaseLockingOptions{
+		Namespace: testNamespace,
+		Identity:  "replica-a",
+	}))
+	require.NoError(t, s.Initialize(nil, nil))
+	require.NotNil(t, s.leaseLocks)
+	runChallengeSteps(t, s, f, []challengeStep{present("key1")})
+	lease, err := s.client.CoordinationV1().Leases(testNamespace).Get(
 		context.Background(),
-		pollInterval,
-		propagationLimit,
-		true,
-		allConditions(
-			recordHasPropagatedCheck(testNameServer, ch1.ResolvedFQDN, ch1.Key),
-			recordHasPropagatedCheck(testNameServer, ch2.ResolvedFQDN, ch2.Key),
-		)); err != nil {
-		t.Errorf("error waiting for DNS record propagation: %v", err)
-		return
+		leaseName(testZone),
+		metav1.GetOptions{},
+	)
+	require.NoError(t, err)
+	// The Lease should have been released
+	require.Nil(t, lease.Spec.HolderIdentity)
+}
+
+func TestSolverLeaseLockingMisconfigured(t *testing.T) {
+	s := newTestSolver(t, WithLeaseLocking(LeaseLockingOptions{
+		Identity: "replica-a",
+	}))
+	require.ErrorContains(t, s.Initialize(nil, nil), "requires both a namespace and an identity")
+}
+
+func TestSolverLeaseDurationTooShort(t *testing.T) {
+	s := newTestSolver(t, WithLeaseLocking(LeaseLockingOptions{
+		Namespace:     testNamespace,
+		Identity:      "replica-a",
+		LeaseDuration: challengeTimeout,
+	}))
+	require.ErrorContains(t, s.Initialize(nil, nil), "must exceed the challenge timeout")
+}
+
+func TestSolverGetAccessToken(t *testing.T) {
+	const credentialsNamespace = "dns-credentials"
+	testCases := []struct {
+		name              string
+		opts              []SolverOption
+		resourceNamespace string
+		secretNamespace   string
+		useFile           bool
+		useEnv            bool
+		assertions        func(*testing.T, string, error)
+	}{
+		{
+			name:              "Issuer referencing its own namespace implicitly",
+			resourceNamespace: "team-a",
+			assertions: func(t *testing.T, token string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "team-a-token", token)
+			},
+		},
+		{
+			name:              "Issuer referencing its own namespace explicitly",
+			resourceNamespace: "team-a",
+			secretNamespace:   "team-a",
+			assertions: func(t *testing.T, token string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "team-a-token", token)
+			},
+		},
+		{
+			name:              "Issuer referencing another namespace",
+			resourceNamespace: "team-a",
+			secretNamespace:   credentialsNamespace,
+			assertions: func(t *testing.T, _ string, err error) {
+				require.ErrorContains(t, err, "only ClusterIssuers may reference Secrets")
+			},
+		},
+		{
+			name:              "ClusterIssuer referencing the cluster resource namespace",
+			resourceNamespace: testNamespace,
+			assertions: func(t *testing.T, token string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, testToken, token)
+			},
+		},
+		{
+			name:              "ClusterIssuer referencing another namespace",
+			resourceNamespace: testNamespace,
+			secretNamespace:   credentialsNamespace,
+			assertions: func(t *testing.T, token string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "central-token", token)
+			},
+		},
+		{
+			name:              "ClusterIssuer with custom cluster resource namespace",
+			opts:              []SolverOption{WithClusterResourceNamespace("team-a")},
+			resourceNamespace: "team-a",
+			secretNamespace:   credentialsNamespace,
+			assertions: func(t *testing.T, token string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "central-token", token)
+			},
+		},
+		{
+			name:              "former cluster resource namespace",
+			opts:              []SolverOption{WithClusterResourceNamespace("team-a")},
+			resourceNamespace: testNamespace,
+			secretNamespace:   credentialsNamespace,
+			assertions: func(t *testing.T, _ string, err error) {
+				require.ErrorContains(t, err, "only ClusterIssuers may reference Secrets")
+			},
+		},
+		{
+			name:              "Secret not found",
+			resourceNamespace: testNamespace,
+			secretNamespace:   "nonexistent",
+			assertions: func(t *testing.T, _ string, err error) {
+				require.ErrorContains(t, err, `in namespace "nonexistent"`)
+			},
+		},
+		{
+			name:              "ClusterIssuer reading a file",
+			resourceNamespace: testNamespace,
+			useFile:           true,
+			assertions: func(t *testing.T, token string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "file-token", token)
+			},
+		},
+		{
+			name:              "Issuer reading a file",
+			resourceNamespace: "team-a",
+			useFile:           true,
+			assertions: func(t *testing.T, _ string, err error) {
+				require.ErrorContains(t, err, "apiKeyFile is not permitted")
+			},
+		},
+		{
+			name:              "ClusterIssuer reading an environment variable",
+			resourceNamespace: testNamespace,
+			useEnv:            true,
+			assertions: func(t *testing.T, token string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "env-token", token)
+			},
+		},
+		{
+			name:              "Issuer reading an environment variable",
+			resourceNamespace: "team-a",
+			useEnv:            true,
+			assertions: func(t *testing.T, _ string, err error) {
+				require.ErrorContains(t, err, "apiKeyEnv is not permitted")
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			s := newTestSolver(t, testCase.opts...)
+			s.client = fake.NewClientset(
+				newTestSecret(testNamespace, testToken),
+				newTestSecret("team-a", "team-a-token"),
+				newTestSecret(credentialsNamespace, "central-token"),
+			)
+			cfg := Config{}
+			switch {
+			case testCase.useFile:
+				cfg.APIKeyFile = filepath.Join(t.TempDir(), "token")
+				require.NoError(t, os.WriteFile(cfg.APIKeyFile, []byte("file-token\n"), 0o600))
+			case testCase.useEnv:
+				cfg.APIKeyEnv = "TEST_GANDI_PAT"
+				t.Setenv(cfg.APIKeyEnv, "env-token")
+			default:
+				cfg.APIKeySecretRef = &SecretKeySelector{
+					SecretKeySelector: cmmeta.SecretKeySelector{
+						LocalObjectReference: cmmeta.LocalObjectReference{
+							Name: testSecretName,
+						},
+						Key: testSecretKey,
+					},
+					Namespace: testCase.secretNamespace,
+				}
+			}
+			token, err := s.getAccessToken(
+				context.Background(),
+				testCase.resourceNamespace,
+				cfg,
+			)
+			testCase.assertions(t, token, err)
+		})
+	}
+}
+
+func TestSolverZoneCredentials(t *testing.T) {
+	testCases := []struct {
+		name       string
+		zones      []map[string]any
+		assertions func(*testing.T, *fakeLiveDNS, error)
+	}{
+		{
+			name: "zone selects a working credential",
+			zones: []map[string]any{
+				{
+					"zone": "example.org",
+					"apiKeySecretRef": map[string]any{
+						"name": "nonexistent",
+						"key":  testSecretKey,
+					},
+				},
+				{
+					"zoneSuffix": testZone,
+					"apiKeySecretRef": map[string]any{
+						"name": testSecretName,
+						"key":  testSecretKey,
+					},
+				},
+			},
+			assertions: func(t *testing.T, f *fakeLiveDNS, err error) {
+				require.NoError(t, err)
+				require.NotNil(t, f.get(testZone, testEntryName, "TXT"))
+			},
+		},
+		{
+			name: "no zone matches",
+			zones: []map[string]any{
+				{
+					"zone": "example.org",
+					"apiKeySecretRef": map[string]any{
+						"name": testSecretName,
+						"key":  testSecretKey,
+					},
+				},
+			},
+			assertions: func(t *testing.T, f *fakeLiveDNS, err error) {
+				require.ErrorContains(t, err, "no credentials configured for zone")
+				require.Nil(t, f.get(testZone, testEntryName, "TXT"))
+			},
+		},
 	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			f := newFakeLiveDNS(t)
+			s := newTestSolver(t)
+			cr := newTestChallengeRequest(t, f, "key1")
+			cfg, err := json.Marshal(map[string]any{
+				"zones":                    testCase.zones,
+				"apiEndpoint":              f.url,
+				"allowInsecureAPIEndpoint": true,
+			})
+			require.NoError(t, err)
+			cr.Config.Raw = cfg
+			testCase.assertions(t, f, s.Present(cr))
+		})
+	}
+}
 
-	t.Log("Cleaning up the second record only...")
-	if err := solver.CleanUp(ch2); err != nil {
-		t.Errorf("expected CleanUp to not error, but got: %v", err)
+func TestSolverFollowsCNAMEs(t *testing.T) {
+	const validationZone = "validation.example.net"
+	testCases := []struct {
+		name  string
+		cname func(*testing.T) map[string]any
+	}{
+		{
+			name: "DNS resolver",
+			cname: func(t *testing.T) map[string]any {
+				d := newFakeDNS(t)
+				d.add(
+					t,
+					testSOA(testZone),
+					testSOA(validationZone),
+					fmt.Sprintf(
+						"%s.%s. 300 IN CNAME %s.%s.",
+						testEntryName, testZone, testEntryName, validationZone,
+					),
+				)
+				return map[string]any{"nameservers": []string{d.addr}}
+			},
+		},
+		{
+			name: "API resolver",
+			cname: func(*testing.T) map[string]any {
+				return map[string]any{"resolver": "api"}
+			},
+		},
 	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			f := newFakeLiveDNS(t)
+			f.addDomain(testZone)
+			f.addDomain(validationZone)
+			f.set(testZone, livedns.RRSet{
+				Type:   "CNAME",
+				TTL:    minTTL,
+				Name:   testEntryName,
+				Values: []string{fmt.Sprintf("%s.%s.", testEntryName, validationZone)},
+			})
+			s := newTestSolver(t)
+			cr := newTestChallengeRequest(t, f, "key1")
+			cfg, err := json.Marshal(map[string]any{
+				"apiKeySecretRef": map[string]any{
+					"name": testSecretName,
+					"key":  testSecretKey,
+				},
+				"apiEndpoint":              f.url,
+				"allowInsecureAPIEndpoint": true,
+				"cname":                    testCase.cname(t),
+			})
+			require.NoError(t, err)
+			cr.Config.Raw = cfg
 
-	t.Log(
-		"Waiting for propagation. Expecting first record to still exist, but " +
-			"second record to be deleted...",
-	)
-	if err := wait.PollUntilContextTimeout(
-		context.Background(),
-		pollInterval,
-		propagationLimit,
-		true,
-		allConditions(
-			recordHasBeenDeletedCheck(testNameServer, ch2.ResolvedFQDN, ch2.Key),
-			recordHasPropagatedCheck(testNameServer, ch1.ResolvedFQDN, ch1.Key),
-		)); err != nil {
-		t.Errorf("error waiting for DNS record propagation: %v", err)
-		return
-	}
-}
-
-func randomString() string {
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	seededRand := rand.New(rand.NewSource(time.Now().UnixNano())) // nolint: gosec
-	b := make([]byte, 8)
-	for i := range b {
-		b[i] = charset[seededRand.Intn(len(charset))]
-	}
-	return string(b)
-}
-
-func allConditions(c ...wait.ConditionWithContextFunc) wait.ConditionWithContextFunc {
-	return func(ctx context.Context) (bool, error) {
-		for _, fn := range c {
-			ok, err := fn(ctx)
-			if err != nil || !ok {
-				return ok, err
-			}
-		}
-		return true, nil
+			require.NoError(t, s.Present(cr))
+			rrs := f.get(validationZone, testEntryName, "TXT")
+			require.NotNil(t, rrs)
+			require.Equal(t, []string{`"key1"`}, rrs.Values)
+			// The delegating zone must not have been touched
+			require.Nil(t, f.get(testZone, testEntryName, "TXT"))
+
+			require.NoError(t, s.CleanUp(cr))
+			require.Nil(t, f.get(validationZone, testEntryName, "TXT"))
+		})
 	}
 }
 
-func recordHasPropagatedCheck(nameServer, fqdn, value string) func(ctx context.Context) (bool, error) {
-	return func(ctx context.Context) (bool, error) {
-		return util.PreCheckDNS(ctx, fqdn, value, []string{nameServer}, true)
+// newTestSolver returns a solver that reads the access token from a fake
+// clientset.
+func newTestSolver(t *testing.T, opts ...SolverOption) *solver {
+	s, ok := NewSolver(opts...).(*solver)
+	require.True(t, ok)
+	s.client = fake.NewClientset(newTestSecret(testNamespace, testToken))
+	s.challenges = cmfake.NewSimpleClientset()
+	return s
+}
+
+// newTestChallengeRequest returns a ChallengeRequest for the given key that
+// directs the solver to the given fake LiveDNS API.
+func newTestChallengeRequest(
+	t *testing.T,
+	f *fakeLiveDNS,
+	key string,
+) *v1alpha1.ChallengeRequest {
+	cfg, err := json.Marshal(map[string]any{
+		"apiKeySecretRef": map[string]any{
+			"name": testSecretName,
+			"key":  testSecretKey,
+		},
+		"apiEndpoint":              f.url,
+		"allowInsecureAPIEndpoint": true,
+		// The fake LiveDNS API imposes no rate limit, so there is no need to
+		// slow down tests that make many requests.
+		"rateLimit": map[string]any{
+			"requestsPerSecond": 1000,
+			"burst":             1000,
+		},
+	})
+	require.NoError(t, err)
+	return &v1alpha1.ChallengeRequest{
+		ResourceNamespace: testNamespace,
+		ResolvedFQDN:      fmt.Sprintf("%s.%s.", testEntryName, testZone),
+		ResolvedZone:      fmt.Sprintf("%s.", testZone),
+		DNSName:           testZone,
+		Key:               key,
+		Config:            &apiextensionsv1.JSON{Raw: cfg},
 	}
 }
 
-func recordHasBeenDeletedCheck(nameServer, fqdn, value string) func(ctx context.Context) (bool, error) {
-	return func(ctx context.Context) (bool, error) {
-		msg, err := util.DNSQuery(ctx, fqdn, dns.TypeTXT, []string{nameServer}, true)
-		if err != nil {
-			return false, err
-		}
-		if msg.Rcode == dns.RcodeNameError {
-			return true, nil
+func runChallengeSteps(
+	t *testing.T,
+	s *solver,
+	f *fakeLiveDNS,
+	steps []challengeStep,
+) {
+	for _, step := range steps {
+		cr := newTestChallengeRequest(t, f, step.key)
+		if step.cleanUp {
+			require.NoError(t, s.CleanUp(cr), "CleanUp %s", step.key)
+		} else {
+			require.NoError(t, s.Present(cr), "Present %s", step.key)
 		}
-		if msg.Rcode != dns.RcodeSuccess {
-			return false, fmt.Errorf("unexpected error from DNS server: %v", dns.RcodeToString[msg.Rcode])
-		}
-		for _, rr := range msg.Answer {
-			txt, ok := rr.(*dns.TXT)
-			if !ok {
-				continue
-			}
-			for _, k := range txt.Txt {
-				if k == value {
-					return false, nil
-				}
-			}
+	}
+}
+
+func TestSolverLogsChallengeFields(t *testing.T) {
+	f := newFakeLiveDNS(t)
+	var buf bytes.Buffer
+	s := newTestSolver(t, WithLogger(slog.New(slog.NewJSONHandler(
+		&buf,
+		&slog.HandlerOptions{Level: slog.LevelDebug},
+	))))
+	cr := newTestChallengeRequest(t, f, "key1")
+	cr.UID = "7f5b2a6c-challenge"
+	require.NoError(t, s.Present(cr))
+	f.failWith(http.MethodDelete, http.StatusForbidden)
+	require.Error(t, s.CleanUp(cr))
+
+	dec := json.NewDecoder(&buf)
+	var lines []map[string]any
+	for dec.More() {
+		var line map[string]any
+		require.NoError(t, dec.Decode(&line))
+		lines = append(lines, line)
+	}
+	require.NotEmpty(t, lines)
+	for _, line := range lines {
+		for _, field := range []string{"uid", "zone", "entry", "action", "httpStatus", "durationMs"} {
+			require.Contains(t, line, field, "line %v", line)
 		}
-		return true, nil
+		require.Equal(t, "7f5b2a6c-challenge", line["uid"])
+		require.Equal(t, testZone, line["zone"])
+		require.Equal(t, testEntryName, line["entry"])
 	}
+	last := lines[len(lines)-1]
+	require.Equal(t, "ERROR", last["level"])
+	require.Equal(t, actionCleanUp, last["action"])
+	require.EqualValues(t, http.StatusForbidden, last["httpStatus"])
+	require.Contains(t, last["error"], "token lacks LiveDNS permission")
 }
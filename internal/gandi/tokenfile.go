@@ -0,0 +1,64 @@
+package gandi
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenFileCache serves credentials read from files, re-reading a file only
+// when its modification time or size has changed since it was last read. This
+// keeps rotated credentials, such as those mounted by the Secrets Store CSI
+// driver, current without reading the file for every request.
+type tokenFileCache struct {
+	mu    sync.Mutex
+	files map[string]tokenFile
+}
+
+// tokenFile is the most recently read contents of a token file along with the
+// attributes that were used to detect changes to it.
+type tokenFile struct {
+	modTime time.Time
+	size    int64
+	token   string
+}
+
+func newTokenFileCache() *tokenFileCache {
+	return &tokenFileCache{
+		files: map[string]tokenFile{},
+	}
+}
+
+// get returns the credential contained in the file at the given path, with
+// any surrounding whitespace removed.
+func (c *tokenFileCache) get(path string) (string, error) {
+	// os.Stat follows symlinks, so a file that is replaced by swapping a
+	// symlink, as is done for projected and CSI volumes, is detected as changed.
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading token file %q: %w", path, err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.files[path]; ok &&
+		cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.token, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading token file %q: %w", path, err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		delete(c.files, path)
+		return "", fmt.Errorf("token file %q is empty", path)
+	}
+	c.files[path] = tokenFile{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		token:   token,
+	}
+	return token, nil
+}
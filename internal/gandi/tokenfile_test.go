@@ -0,0 +1,70 @@
+package gandi
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenFileCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	c := newTokenFileCache()
+
+	_, err := c.get(path)
+	require.ErrorContains(t, err, "error reading token file")
+
+	require.NoError(t, os.WriteFile(path, []byte("token-a\n"), 0o600))
+	token, err := c.get(path)
+	require.NoError(t, err)
+	require.Equal(t, "token-a", token)
+
+	// An unchanged file should be served from the cache
+	c.files[path] = tokenFile{
+		modTime: c.files[path].modTime,
+		size:    c.files[path].size,
+		token:   "cached",
+	}
+	token, err = c.get(path)
+	require.NoError(t, err)
+	require.Equal(t, "cached", token)
+
+	// A rotated file should be re-read
+	require.NoError(t, os.WriteFile(path, []byte("token-b\n"), 0o600))
+	require.NoError(t, os.Chtimes(path, time.Time{}, time.Now().Add(time.Minute)))
+	token, err = c.get(path)
+	require.NoError(t, err)
+	require.Equal(t, "token-b", token)
+
+	// An emptied file is an error and must not leave a stale token behind
+	require.NoError(t, os.WriteFile(path, []byte("\n"), 0o600))
+	_, err = c.get(path)
+	require.ErrorContains(t, err, "is empty")
+	require.NotContains(t, c.files, path)
+}
+
+func TestTokenFileCacheSymlinkSwap(t *testing.T) {
+	// Projected and CSI volumes replace their contents by atomically swapping a
+	// symlink to a new directory.
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "v1"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "v1", "token"), []byte("token-a"), 0o600))
+	require.NoError(t, os.Symlink("v1", filepath.Join(dir, "..data")))
+	require.NoError(t, os.Symlink(filepath.Join("..data", "token"), filepath.Join(dir, "token")))
+	path := filepath.Join(dir, "token")
+	c := newTokenFileCache()
+
+	token, err := c.get(path)
+	require.NoError(t, err)
+	require.Equal(t, "token-a", token)
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "v2"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "v2", "token"), []byte("token-bb"), 0o600))
+	require.NoError(t, os.Symlink("v2", filepath.Join(dir, "..data_tmp")))
+	require.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+	token, err = c.get(path)
+	require.NoError(t, err)
+	require.Equal(t, "token-bb", token)
+}
@@ -0,0 +1,52 @@
+package gandi
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the instrumentation scope of spans started by the
+// solver and its LiveDNS API client.
+const tracerName = "github.com/krancovia/cert-manager-webhook-gandi/internal/gandi"
+
+// Attributes of spans started by the solver and its LiveDNS API client.
+const (
+	zoneAttribute             = attribute.Key("gandi.zone")
+	entryAttribute            = attribute.Key("gandi.entry")
+	credentialSourceAttribute = attribute.Key("gandi.credential_source")
+)
+
+// startSpan starts a span with the given name and attributes using the global
+// TracerProvider, which does nothing unless tracing has been configured.
+func startSpan(
+	ctx context.Context,
+	name string,
+	attrs ...attribute.KeyValue,
+) (context.Context, trace.Span) {
+	// The Tracer is obtained anew for every span so that changes to the global
+	// TracerProvider are always respected.
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends the given span, recording the given error, if any, as the
+// reason it failed.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// recordAttributes returns span attributes identifying the record with the
+// given name in the given zone.
+func recordAttributes(zone string, entry string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		zoneAttribute.String(zone),
+		entryAttribute.String(entry),
+	}
+}
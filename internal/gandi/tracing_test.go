@@ -0,0 +1,95 @@
+package gandi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// newTestSpanExporter installs a global TracerProvider that exports spans to
+// the returned in-memory exporter for the duration of the test.
+func newTestSpanExporter(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+	})
+	return exporter
+}
+
+// spanAttributes returns the attributes of the given span as a map.
+func spanAttributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, attr := range span.Attributes {
+		attrs[attr.Key] = attr.Value
+	}
+	return attrs
+}
+
+func TestSolverTracing(t *testing.T) {
+	exporter := newTestSpanExporter(t)
+	f := newFakeLiveDNS(t)
+	s := newTestSolver(t)
+	runChallengeSteps(t, s, f, []challengeStep{present("key1")})
+
+	spans := exporter.GetSpans()
+	byName := map[string]tracetest.SpanStub{}
+	for _, span := range spans {
+		byName[span.Name] = span
+	}
+	root, ok := byName["solver."+actionPresent]
+	require.True(t, ok)
+	require.False(t, root.Parent.IsValid())
+	require.Equal(t, testZone, spanAttributes(root)[zoneAttribute].AsString())
+	require.Equal(t, testEntryName, spanAttributes(root)[entryAttribute].AsString())
+
+	for _, name := range []string{"getAccessToken", "lockZone"} {
+		span, ok := byName[name]
+		require.True(t, ok, "span %q", name)
+		require.Equal(t, root.SpanContext.SpanID(), span.Parent.SpanID(), "span %q", name)
+	}
+	require.Equal(
+		t,
+		"apiKeySecretRef",
+		spanAttributes(byName["getAccessToken"])[credentialSourceAttribute].AsString(),
+	)
+
+	for name, status := range map[string]int64{
+		"LiveDNS getRecord":       404,
+		"LiveDNS createTxtRecord": 201,
+	} {
+		span, ok := byName[name]
+		require.True(t, ok, "span %q", name)
+		require.Equal(t, root.SpanContext.SpanID(), span.Parent.SpanID(), "span %q", name)
+		attrs := spanAttributes(span)
+		require.Equal(t, testZone, attrs[zoneAttribute].AsString())
+		require.Equal(t, testEntryName, attrs[entryAttribute].AsString())
+		require.Equal(t, status, attrs["http.response.status_code"].AsInt64())
+		// Each attempt is traced by the instrumented transport
+		var attempts int
+		for _, child := range spans {
+			if child.Parent.SpanID() == span.SpanContext.SpanID() {
+				attempts++
+			}
+		}
+		require.Equal(t, 1, attempts, "span %q", name)
+	}
+}
+
+func TestSolverTracingFailure(t *testing.T) {
+	exporter := newTestSpanExporter(t)
+	s := newTestSolver(t)
+	cr := newTestChallengeRequest(t, newFakeLiveDNS(t), "key1")
+	cr.Config = nil
+	require.Error(t, s.Present(cr))
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	require.Equal(t, codes.Error, spans[0].Status.Code)
+	require.Equal(t, "no solver config found", spans[0].Status.Description)
+}
@@ -0,0 +1,241 @@
+package gandi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// defaultLeaseDuration is the default time after which a zone Lease that
+	// has not been released is considered abandoned. It comfortably exceeds the
+	// longest time for which any challenge can hold a zone lock.
+	defaultLeaseDuration = challengeTimeout + 15*time.Second
+	// leaseRetryPeriod is the time between attempts to acquire a zone Lease
+	// that is held by another replica.
+	leaseRetryPeriod = 500 * time.Millisecond
+	// leaseReleaseTimeout bounds the time spent releasing a zone Lease.
+	leaseReleaseTimeout = 10 * time.Second
+	// leaseNamePrefix is prepended to the name of a zone to derive the name of
+	// the corresponding Lease.
+	leaseNamePrefix = "gandi-zone-"
+)
+
+// LeaseLockingOptions configures zone locking across multiple replicas of the
+// webhook using coordination.k8s.io/v1 Leases.
+type LeaseLockingOptions struct {
+	// Namespace is the namespace in which zone Leases are created.
+	Namespace string
+	// Identity uniquely identifies this replica of the webhook among all
+	// replicas competing for zone Leases. The Pod name is a good choice.
+	Identity string
+	// LeaseDuration is the time after which a zone Lease that was never
+	// released (because its holder crashed, for instance) is considered expired
+	// and may be taken over by another replica. Leases are never renewed, so it
+	// must exceed the longest time for which any challenge can hold a zone
+	// lock. If zero, a sensible default is used.
+	LeaseDuration time.Duration
+}
+
+// leaseZoneLocker locks zones across all replicas of the webhook by means of
+// one Lease per zone. Callers within the same replica are first serialized
+// in-process so that at most one of them competes for a zone's Lease at any
+// given time.
+type leaseZoneLocker struct {
+	local         *zoneLockManager
+	client        kubernetes.Interface
+	namespace     string
+	identity      string
+	leaseDuration time.Duration
+	retryPeriod   time.Duration
+	// logger is used to log failures to release a Lease outside of any
+	// challenge, as happens during garbage collection.
+	logger *slog.Logger
+	now    func() time.Time // Overridable for testing purposes
+}
+
+func newLeaseZoneLocker(
+	local *zoneLockManager,
+	client kubernetes.Interface,
+	opts LeaseLockingOptions,
+	logger *slog.Logger,
+) *leaseZoneLocker {
+	leaseDuration := opts.LeaseDuration
+	if leaseDuration <= 0 {
+		leaseDuration = defaultLeaseDuration
+	}
+	return &leaseZoneLocker{
+		local:         local,
+		client:        client,
+		namespace:     opts.Namespace,
+		identity:      opts.Identity,
+		leaseDuration: leaseDuration,
+		retryPeriod:   leaseRetryPeriod,
+		logger:        logger,
+		now:           time.Now,
+	}
+}
+
+// acquire blocks until this replica holds the Lease for the given zone or the
+// given context is done, whichever comes first. On success, it returns a
+// function that releases the Lease. The function is safe to call more than
+// once.
+func (l *leaseZoneLocker) acquire(
+	ctx context.Context,
+	zone string,
+) (func(), error) {
+	releaseLocal, err := l.local.acquire(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	name := leaseName(zone)
+	for {
+		acquired, err := l.tryAcquire(ctx, name)
+		if err != nil {
+			releaseLocal()
+			return nil, fmt.Errorf("error acquiring Lease for zone %q: %w", zone, err)
+		}
+		if acquired {
+			// Leases are held per replica, so releasing one a second time could
+			// release it out from under another caller in this replica that has
+			// since acquired it.
+			var once sync.Once
+			return func() {
+				once.Do(func() {
+					l.release(ctx, name)
+					releaseLocal()
+				})
+			}, nil
+		}
+		if err = sleep(ctx, l.retryPeriod); err != nil {
+			releaseLocal()
+			return nil, fmt.Errorf(
+				"gave up waiting for Lease for zone %q: %w",
+				zone, err,
+			)
+		}
+	}
+}
+
+// tryAcquire makes a single attempt at taking the named Lease. It returns true
+// if the Lease is now held by this replica or false if it is held by another.
+// Losing a race with another replica is not an error.
+func (l *leaseZoneLocker) tryAcquire(
+	ctx context.Context,
+	name string,
+) (bool, error) {
+	leases := l.client.CoordinationV1().Leases(l.namespace)
+	now := metav1.NewMicroTime(l.now())
+	lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = leases.Create(
+			ctx,
+			&coordinationv1.Lease{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: l.namespace,
+					Name:      name,
+				},
+				Spec: l.leaseSpec(now),
+			},
+			metav1.CreateOptions{},
+		)
+		if apierrors.IsAlreadyExists(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
+	}
+	// A Lease still carrying our own identity can only have been left behind
+	// by an earlier incarnation of this replica that failed to release it, so
+	// it is safe to take over.
+	if holder := ptr.Deref(lease.Spec.HolderIdentity, ""); holder != "" &&
+		holder != l.identity && !l.expired(lease) {
+		return false, nil
+	}
+	lease.Spec = l.leaseSpec(now)
+	if _, err = leases.Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+		if apierrors.IsConflict(err) {
+			// Another replica got there first
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// release relinquishes the named Lease if it is still held by this replica.
+// Failures are logged, along with the fields of the challenge carried by the
+// given context, if any, rather than returned. At worst, other replicas must
+// wait for the Lease to expire.
+func (l *leaseZoneLocker) release(ctx context.Context, name string) {
+	logger := l.logger
+	if log, ok := ctx.Value(challengeLogKey{}).(*challengeLog); ok {
+		logger = log.logger().With("durationMs", log.elapsedMs())
+	}
+	// The caller's context may already be done, so a fresh one is used to
+	// ensure the Lease is released promptly.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), leaseReleaseTimeout)
+	defer cancel()
+	leases := l.client.CoordinationV1().Leases(l.namespace)
+	lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		logger.Error("error getting Lease for release", "lease", name, "error", err)
+		return
+	}
+	if ptr.Deref(lease.Spec.HolderIdentity, "") != l.identity {
+		return
+	}
+	lease.Spec.HolderIdentity = nil
+	lease.Spec.AcquireTime = nil
+	lease.Spec.RenewTime = nil
+	if _, err = leases.Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+		logger.Error("error releasing Lease", "lease", name, "error", err)
+	}
+}
+
+func (l *leaseZoneLocker) leaseSpec(now metav1.MicroTime) coordinationv1.LeaseSpec {
+	return coordinationv1.LeaseSpec{
+		HolderIdentity:       ptr.To(l.identity),
+		LeaseDurationSeconds: ptr.To(int32(l.leaseDuration.Seconds())),
+		AcquireTime:          &now,
+		RenewTime:            &now,
+	}
+}
+
+// expired returns true if the given Lease was last renewed longer ago than
+// its duration.
+func (l *leaseZoneLocker) expired(lease *coordinationv1.Lease) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	expiry := lease.Spec.RenewTime.Add(
+		time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second,
+	)
+	return l.now().After(expiry)
+}
+
+// leaseName returns the name of the Lease used to lock the given zone. Zone
+// names are usually valid resource names already. Those that aren't are
+// hashed.
+func leaseName(zone string) string {
+	name := leaseNamePrefix + strings.ToLower(strings.TrimSuffix(zone, "."))
+	if len(validation.IsDNS1123Subdomain(name)) == 0 {
+		return name
+	}
+	sum := sha256.Sum256([]byte(zone))
+	return leaseNamePrefix + hex.EncodeToString(sum[:])[:32]
+}
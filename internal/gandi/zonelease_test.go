@@ -0,0 +1,260 @@
+package gandi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/stretchr/testify/require"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/utils/ptr"
+)
+
+const testLeaseNamespace = "cert-manager"
+
+func TestLeaseZoneLockerAcquireAndRelease(t *testing.T) {
+	client := fake.NewClientset()
+	l := newTestLeaseZoneLocker(client, "replica-a")
+
+	release, err := l.acquire(context.Background(), testZone)
+	require.NoError(t, err)
+	lease := getTestLease(t, client, testZone)
+	require.Equal(t, "replica-a", ptr.Deref(lease.Spec.HolderIdentity, ""))
+	require.Equal(
+		t,
+		int32(defaultLeaseDuration.Seconds()),
+		ptr.Deref(lease.Spec.LeaseDurationSeconds, 0),
+	)
+	require.NotNil(t, lease.Spec.RenewTime)
+
+	release()
+	lease = getTestLease(t, client, testZone)
+	require.Nil(t, lease.Spec.HolderIdentity)
+	require.Zero(t, l.local.size())
+
+	// The Lease still exists, but is free, so it should be possible to acquire
+	// it again.
+	release, err = l.acquire(context.Background(), testZone)
+	require.NoError(t, err)
+	release()
+}
+
+func TestLeaseZoneLockerReleaseTwice(t *testing.T) {
+	client := fake.NewClientset()
+	l := newTestLeaseZoneLocker(client, "replica-a")
+
+	release, err := l.acquire(context.Background(), testZone)
+	require.NoError(t, err)
+	release()
+
+	// Another caller in the same replica takes the zone
+	releaseOther, err := l.acquire(context.Background(), testZone)
+	require.NoError(t, err)
+	defer releaseOther()
+
+	// Releasing again must not release the other caller's Lease
+	release()
+	lease := getTestLease(t, client, testZone)
+	require.Equal(t, "replica-a", ptr.Deref(lease.Spec.HolderIdentity, ""))
+	require.Equal(t, 1, l.local.size())
+}
+
+func TestLeaseZoneLockerContention(t *testing.T) {
+	client := fake.NewClientset()
+	a := newTestLeaseZoneLocker(client, "replica-a")
+	b := newTestLeaseZoneLocker(client, "replica-b")
+
+	releaseA, err := a.acquire(context.Background(), testZone)
+	require.NoError(t, err)
+
+	// Replica B must not be able to acquire the Lease while A holds it
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = b.acquire(ctx, testZone)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Zero(t, b.local.size())
+
+	// Replica B should acquire the Lease as soon as A releases it
+	acquired := make(chan error)
+	go func() {
+		releaseB, err := b.acquire(context.Background(), testZone)
+		if err == nil {
+			releaseB()
+		}
+		acquired <- err
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("Lease was acquired while held by another replica")
+	case <-time.After(50 * time.Millisecond):
+	}
+	releaseA()
+	select {
+	case err = <-acquired:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Lease was never acquired after being released")
+	}
+}
+
+func TestLeaseZoneLockerTakesOverExpiredLease(t *testing.T) {
+	client := fake.NewClientset()
+	a := newTestLeaseZoneLocker(client, "replica-a")
+	b := newTestLeaseZoneLocker(client, "replica-b")
+
+	// Replica A acquires the Lease and then "crashes" without releasing it
+	_, err := a.acquire(context.Background(), testZone)
+	require.NoError(t, err)
+
+	// Once the Lease has expired, replica B should be able to take it over
+	b.now = func() time.Time {
+		return time.Now().Add(defaultLeaseDuration + time.Second)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	release, err := b.acquire(ctx, testZone)
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		"replica-b",
+		ptr.Deref(getTestLease(t, client, testZone).Spec.HolderIdentity, ""),
+	)
+
+	// Replica A releasing late must not disturb B's hold on the Lease
+	a.release(context.Background(), leaseName(testZone))
+	require.Equal(
+		t,
+		"replica-b",
+		ptr.Deref(getTestLease(t, client, testZone).Spec.HolderIdentity, ""),
+	)
+	release()
+}
+
+func TestLeaseZoneLockerTakesOverOwnStaleLease(t *testing.T) {
+	client := fake.NewClientset()
+	// A previous incarnation of replica A left a Lease behind
+	_, err := newTestLeaseZoneLocker(client, "replica-a").acquire(
+		context.Background(),
+		testZone,
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	release, err := newTestLeaseZoneLocker(client, "replica-a").acquire(ctx, testZone)
+	require.NoError(t, err)
+	release()
+}
+
+func TestLeaseZoneLockerLosesRace(t *testing.T) {
+	client := fake.NewClientset(
+		&coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: testLeaseNamespace,
+				Name:      leaseName(testZone),
+			},
+		},
+	)
+	// Simulate another replica updating the Lease between our read and write
+	client.PrependReactor(
+		"update",
+		"leases",
+		func(k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, apierrors.NewConflict(
+				schema.GroupResource{Group: "coordination.k8s.io", Resource: "leases"},
+				leaseName(testZone),
+				nil,
+			)
+		},
+	)
+	l := newTestLeaseZoneLocker(client, "replica-a")
+	acquired, err := l.tryAcquire(context.Background(), leaseName(testZone))
+	require.NoError(t, err)
+	require.False(t, acquired)
+}
+
+func TestLeaseZoneLockerLogsReleaseFailure(t *testing.T) {
+	client := fake.NewClientset()
+	l := newTestLeaseZoneLocker(client, "replica-a")
+	var buf bytes.Buffer
+	log := newChallengeLog(
+		slog.New(slog.NewJSONHandler(&buf, nil)),
+		v1alpha1.ChallengeRequest{UID: "7f5b2a6c-challenge"},
+		actionPresent,
+		testZone,
+		testEntryName,
+	)
+	release, err := l.acquire(withChallengeLog(context.Background(), log), testZone)
+	require.NoError(t, err)
+	client.PrependReactor(
+		"get",
+		"leases",
+		func(k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("something went wrong")
+		},
+	)
+	release()
+
+	line := map[string]any{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	require.Equal(t, "ERROR", line["level"])
+	require.Equal(t, "7f5b2a6c-challenge", line["uid"])
+	require.Equal(t, actionPresent, line["action"])
+	require.Equal(t, testZone, line["zone"])
+	require.Equal(t, testEntryName, line["entry"])
+	require.Contains(t, line, "durationMs")
+	require.Equal(t, leaseName(testZone), line["lease"])
+}
+
+func TestLeaseName(t *testing.T) {
+	require.Equal(t, "gandi-zone-example.com", leaseName("Example.com."))
+	// Names that would be invalid are hashed
+	name := leaseName(strings.Repeat("a", 300) + ".com")
+	require.True(t, strings.HasPrefix(name, leaseNamePrefix))
+	require.Len(t, name, len(leaseNamePrefix)+32)
+	require.Equal(t, name, leaseName(strings.Repeat("a", 300)+".com"))
+}
+
+func newTestLeaseZoneLocker(
+	client kubernetes.Interface,
+	identity string,
+) *leaseZoneLocker {
+	l := newLeaseZoneLocker(
+		newZoneLockManager(),
+		client,
+		LeaseLockingOptions{
+			Namespace: testLeaseNamespace,
+			Identity:  identity,
+		},
+		slog.Default(),
+	)
+	l.retryPeriod = 5 * time.Millisecond
+	return l
+}
+
+func getTestLease(
+	t *testing.T,
+	client kubernetes.Interface,
+	zone string,
+) *coordinationv1.Lease {
+	lease, err := client.CoordinationV1().Leases(testLeaseNamespace).Get(
+		context.Background(),
+		leaseName(zone),
+		metav1.GetOptions{},
+	)
+	require.NoError(t, err)
+	return lease
+}
@@ -0,0 +1,125 @@
+package gandi
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// zoneLockManager hands out per-zone locks used to serialize the
+// read-modify-write cycles the solver performs on a zone's record sets. A
+// zone's lock exists only for as long as some caller holds or is waiting for
+// it, so the number of locks tracked never exceeds the number of challenges in
+// flight.
+type zoneLockManager struct {
+	mu    sync.Mutex
+	locks map[string]*zoneLock
+	stats zoneLockStats
+}
+
+// zoneLock is a lock on a single zone. It is held by whoever managed to put a
+// token into its channel.
+type zoneLock struct {
+	ch chan struct{}
+	// refs counts the callers currently holding or waiting for the lock. It is
+	// protected by the zoneLockManager's mutex.
+	refs int
+}
+
+// zoneLockStats summarizes the time callers have spent waiting for zone
+// locks.
+type zoneLockStats struct {
+	// Acquisitions is the number of times a zone lock was acquired.
+	Acquisitions uint64
+	// Timeouts is the number of times a caller gave up waiting for a zone lock.
+	Timeouts uint64
+	// TotalWait is the cumulative time spent waiting for zone locks, including
+	// by callers that eventually gave up.
+	TotalWait time.Duration
+	// MaxWait is the longest time any single caller spent waiting for a zone
+	// lock.
+	MaxWait time.Duration
+}
+
+func newZoneLockManager() *zoneLockManager {
+	return &zoneLockManager{
+		locks: map[string]*zoneLock{},
+	}
+}
+
+// acquire blocks until the lock on the given zone has been acquired or the
+// given context is done, whichever comes first. On success, it returns a
+// function that releases the lock. The function is safe to call more than
+// once.
+func (m *zoneLockManager) acquire(
+	ctx context.Context,
+	zone string,
+) (func(), error) {
+	m.mu.Lock()
+	lock, exists := m.locks[zone]
+	if !exists {
+		lock = &zoneLock{ch: make(chan struct{}, 1)}
+		m.locks[zone] = lock
+	}
+	lock.refs++
+	m.mu.Unlock()
+
+	start := time.Now()
+	select {
+	case lock.ch <- struct{}{}:
+		m.observeWait(time.Since(start), false)
+		var once sync.Once
+		return func() {
+			once.Do(func() {
+				<-lock.ch
+				m.unref(zone, lock)
+			})
+		}, nil
+	case <-ctx.Done():
+		m.observeWait(time.Since(start), true)
+		m.unref(zone, lock)
+		return nil, fmt.Errorf(
+			"gave up waiting for lock on zone %q: %w",
+			zone, ctx.Err(),
+		)
+	}
+}
+
+// unref drops a reference to the given zone's lock and evicts the lock once no
+// one holds or is waiting for it anymore.
+func (m *zoneLockManager) unref(zone string, lock *zoneLock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lock.refs--
+	if lock.refs == 0 {
+		delete(m.locks, zone)
+	}
+}
+
+func (m *zoneLockManager) observeWait(wait time.Duration, timedOut bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if timedOut {
+		m.stats.Timeouts++
+	} else {
+		m.stats.Acquisitions++
+	}
+	m.stats.TotalWait += wait
+	m.stats.MaxWait = max(m.stats.MaxWait, wait)
+}
+
+// waitStats returns a snapshot of statistics about time spent waiting for zone
+// locks.
+func (m *zoneLockManager) waitStats() zoneLockStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stats
+}
+
+// size returns the number of zone locks currently tracked.
+func (m *zoneLockManager) size() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.locks)
+}
@@ -0,0 +1,40 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+const (
+	// FormatText selects human-readable key=value output.
+	FormatText = "text"
+	// FormatJSON selects output with one JSON object per line.
+	FormatJSON = "json"
+)
+
+// NewLogger returns a structured logger that writes lines at or above the
+// given level to the given writer in the given format. An empty format or
+// level selects text output or the info level, respectively. Levels are
+// parsed as by slog.Level's UnmarshalText, so "debug", "info", "warn", and
+// "error" are all accepted, in any case.
+func NewLogger(w io.Writer, format string, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if level != "" {
+		if err := lvl.UnmarshalText([]byte(level)); err != nil {
+			return nil, fmt.Errorf("invalid log level %q: %w", level, err)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(format) {
+	case "", FormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf(
+		"invalid log format %q; must be %q or %q",
+		format, FormatText, FormatJSON,
+	)
+}
@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLogger(t *testing.T) {
+	testCases := []struct {
+		name       string
+		format     string
+		level      string
+		assertions func(*testing.T, string, error)
+	}{
+		{
+			name: "defaults",
+			assertions: func(t *testing.T, out string, err error) {
+				require.NoError(t, err)
+				require.NotContains(t, out, "level=DEBUG")
+				require.Contains(t, out, `level=INFO msg=info key=value`)
+			},
+		},
+		{
+			name:   "JSON at debug level",
+			format: "JSON",
+			level:  "debug",
+			assertions: func(t *testing.T, out string, err error) {
+				require.NoError(t, err)
+				dec := json.NewDecoder(bytes.NewBufferString(out))
+				var line map[string]any
+				require.NoError(t, dec.Decode(&line))
+				require.Equal(t, "DEBUG", line["level"])
+				require.Equal(t, "value", line["key"])
+			},
+		},
+		{
+			name:  "error level",
+			level: "ERROR",
+			assertions: func(t *testing.T, out string, err error) {
+				require.NoError(t, err)
+				require.Empty(t, out)
+			},
+		},
+		{
+			name:   "invalid format",
+			format: "xml",
+			assertions: func(t *testing.T, _ string, err error) {
+				require.ErrorContains(t, err, `invalid log format "xml"`)
+			},
+		},
+		{
+			name:  "invalid level",
+			level: "verbose",
+			assertions: func(t *testing.T, _ string, err error) {
+				require.ErrorContains(t, err, `invalid log level "verbose"`)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger, err := NewLogger(&buf, testCase.format, testCase.level)
+			if err == nil {
+				logger.Debug("debug", "key", "value")
+				logger.Info("info", "key", "value")
+				require.True(t, logger.Enabled(context.Background(), slog.LevelError))
+			}
+			testCase.assertions(t, buf.String(), err)
+		})
+	}
+}
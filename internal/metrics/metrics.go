@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/krancovia/cert-manager-webhook-gandi/internal/version"
+)
+
+// shutdownTimeout bounds the time spent waiting for in-flight scrapes when the
+// metrics server shuts down.
+const shutdownTimeout = 5 * time.Second
+
+// NewRegistry returns a registry of the standard Go runtime and process
+// metrics along with a build_info gauge describing the given version.
+func NewRegistry(ver version.Version) *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Namespace: "gandi_webhook",
+				Name:      "build_info",
+				Help:      "Always 1. Labeled with information about the build.",
+				ConstLabels: prometheus.Labels{
+					"version":        ver.Version,
+					"build_date":     ver.BuildDate.UTC().Format(time.RFC3339),
+					"git_commit":     ver.GitCommit,
+					"git_tree_dirty": strconv.FormatBool(ver.GitTreeDirty),
+					"go_version":     ver.GoVersion,
+					"compiler":       ver.Compiler,
+					"platform":       ver.Platform,
+				},
+			},
+			func() float64 { return 1 },
+		),
+	)
+	return reg
+}
+
+// Serve serves the metrics in the given registry at /metrics on the given
+// address until the given context is canceled.
+func Serve(ctx context.Context, addr string, reg *prometheus.Registry) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg}))
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
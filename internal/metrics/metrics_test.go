@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+
+	"github.com/krancovia/cert-manager-webhook-gandi/internal/version"
+)
+
+func TestNewRegistry(t *testing.T) {
+	reg := NewRegistry(version.Version{
+		Version:      "v1.2.3",
+		BuildDate:    time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC),
+		GitCommit:    "abc123",
+		GitTreeDirty: true,
+		GoVersion:    "go1.23.2",
+		Compiler:     "gc",
+		Platform:     "linux/amd64",
+	})
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	idx := slices.IndexFunc(families, func(mf *dto.MetricFamily) bool {
+		return mf.GetName() == "gandi_webhook_build_info"
+	})
+	require.NotEqual(t, -1, idx)
+	require.Len(t, families[idx].GetMetric(), 1)
+	metric := families[idx].GetMetric()[0]
+	require.Equal(t, 1.0, metric.GetGauge().GetValue())
+	labels := map[string]string{}
+	for _, label := range metric.GetLabel() {
+		labels[label.GetName()] = label.GetValue()
+	}
+	require.Equal(
+		t,
+		map[string]string{
+			"version":        "v1.2.3",
+			"build_date":     "2024-10-01T12:00:00Z",
+			"git_commit":     "abc123",
+			"git_tree_dirty": "true",
+			"go_version":     "go1.23.2",
+			"compiler":       "gc",
+			"platform":       "linux/amd64",
+		},
+		labels,
+	)
+}
@@ -0,0 +1,91 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	"github.com/krancovia/cert-manager-webhook-gandi/internal/version"
+)
+
+// serviceName is the default name of the service to which spans are
+// attributed. It may be overridden using OTEL_SERVICE_NAME.
+const serviceName = "cert-manager-webhook-gandi"
+
+// Enabled returns true if the standard OTEL_* environment variables call for
+// spans to be exported. That is the case when an OTLP endpoint is configured,
+// unless the SDK or the exporter of traces is explicitly disabled.
+func Enabled() bool {
+	if disabled, _ := strconv.ParseBool(os.Getenv("OTEL_SDK_DISABLED")); disabled {
+		return false
+	}
+	if strings.EqualFold(os.Getenv("OTEL_TRACES_EXPORTER"), "none") {
+		return false
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" ||
+		os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// Setup installs a global TracerProvider that exports spans over OTLP/gRPC as
+// configured by the standard OTEL_* environment variables, along with the W3C
+// trace context propagator. If tracing is not enabled, the global
+// TracerProvider is left as it is, which by default does nothing. The
+// returned function flushes any buffered spans and shuts the TracerProvider
+// down.
+func Setup(ctx context.Context, ver version.Version) (func(context.Context) error, error) {
+	if !Enabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+	protocol := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL")
+	if protocol == "" {
+		protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+	if protocol != "" && protocol != "grpc" {
+		return nil, fmt.Errorf(
+			"unsupported OTLP protocol %q; only \"grpc\" is supported",
+			protocol,
+		)
+	}
+	exporter, err := otlptracegrpc.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error creating OTLP trace exporter: %w", err)
+	}
+	// Attributes from the environment take precedence over the defaults
+	res, err := resource.New(
+		ctx,
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(
+			semconv.ServiceName(serviceName),
+			semconv.ServiceVersion(ver.Version),
+		),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, errors.Join(
+			fmt.Errorf("error building trace resource: %w", err),
+			exporter.Shutdown(ctx),
+		)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(
+		propagation.NewCompositeTextMapPropagator(
+			propagation.TraceContext{},
+			propagation.Baggage{},
+		),
+	)
+	return tp.Shutdown, nil
+}
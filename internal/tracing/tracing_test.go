@@ -0,0 +1,72 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/krancovia/cert-manager-webhook-gandi/internal/version"
+)
+
+func TestEnabled(t *testing.T) {
+	testCases := []struct {
+		name    string
+		env     map[string]string
+		enabled bool
+	}{
+		{
+			name: "not configured",
+		},
+		{
+			name:    "endpoint configured",
+			env:     map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4317"},
+			enabled: true,
+		},
+		{
+			name:    "traces endpoint configured",
+			env:     map[string]string{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "http://collector:4317"},
+			enabled: true,
+		},
+		{
+			name: "SDK disabled",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4317",
+				"OTEL_SDK_DISABLED":           "true",
+			},
+		},
+		{
+			name: "traces exporter disabled",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4317",
+				"OTEL_TRACES_EXPORTER":        "none",
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			for _, name := range []string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT",
+				"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT",
+				"OTEL_SDK_DISABLED",
+				"OTEL_TRACES_EXPORTER",
+			} {
+				t.Setenv(name, testCase.env[name])
+			}
+			require.Equal(t, testCase.enabled, Enabled())
+		})
+	}
+}
+
+func TestSetup(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	shutdown, err := Setup(context.Background(), version.Version{})
+	require.NoError(t, err)
+	require.NoError(t, shutdown(context.Background()))
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318")
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "http/protobuf")
+	_, err = Setup(context.Background(), version.Version{})
+	require.ErrorContains(t, err, `unsupported OTLP protocol "http/protobuf"`)
+}
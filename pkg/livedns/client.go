@@ -0,0 +1,238 @@
+// Package livedns is a client for the Gandi LiveDNS API, which manages the
+// domains hosted by Gandi's DNS service and their resource record sets.
+package livedns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultEndpoint is the base URL of the official Gandi LiveDNS API.
+const DefaultEndpoint = "https://api.gandi.net/v5/livedns"
+
+const (
+	// defaultPageSize is the number of items requested per page when listing.
+	defaultPageSize = 100
+	// defaultTimeout bounds the time spent on a single request by the default
+	// HTTP client.
+	defaultTimeout = 30 * time.Second
+	// totalCountHeader is the response header in which Gandi reports the total
+	// number of items in a paginated listing.
+	totalCountHeader = "Total-Count"
+)
+
+// HTTPDoer executes HTTP requests. It is satisfied by *http.Client, and may be
+// implemented by middleware that adds behavior such as retries or rate
+// limiting. Requests with a body always have GetBody set, so they may be
+// repeated.
+type HTTPDoer interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// Client is a client for the Gandi LiveDNS API authenticated by a single
+// credential. It is safe for concurrent use.
+type Client struct {
+	endpoint   string
+	token      string
+	apiKey     bool
+	httpClient HTTPDoer
+	userAgent  string
+	pageSize   int
+}
+
+// Option is a function that configures optional behavior of the Client
+// returned by NewClient.
+type Option func(*Client)
+
+// WithEndpoint returns an Option that makes the Client use the given base URL
+// of the LiveDNS API instead of DefaultEndpoint. Any trailing slash is
+// removed. An empty URL is ignored.
+func WithEndpoint(endpoint string) Option {
+	return func(c *Client) {
+		if endpoint != "" {
+			c.endpoint = strings.TrimSuffix(endpoint, "/")
+		}
+	}
+}
+
+// WithHTTPClient returns an Option that makes the Client execute requests
+// using the given HTTPDoer instead of an *http.Client with a 30 second
+// timeout.
+func WithHTTPClient(httpClient HTTPDoer) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithAPIKey returns an Option that makes the Client present its credential
+// as a legacy (deprecated) Gandi API key instead of a personal access token.
+func WithAPIKey() Option {
+	return func(c *Client) {
+		c.apiKey = true
+	}
+}
+
+// WithUserAgent returns an Option that makes the Client identify itself with
+// the given User-Agent header.
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithPageSize returns an Option that makes the Client request the given
+// number of items per page when listing. Non-positive values are ignored.
+func WithPageSize(pageSize int) Option {
+	return func(c *Client) {
+		if pageSize > 0 {
+			c.pageSize = pageSize
+		}
+	}
+}
+
+// NewClient returns a Client authenticated by the given personal access token
+// or, with WithAPIKey, legacy API key.
+func NewClient(token string, opts ...Option) *Client {
+	c := &Client{
+		endpoint:   DefaultEndpoint,
+		token:      token,
+		httpClient: &http.Client{Timeout: defaultTimeout},
+		pageSize:   defaultPageSize,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// authorization returns the value of the Authorization header appropriate for
+// the client's credential.
+func (c *Client) authorization() string {
+	if c.apiKey {
+		return "Apikey " + c.token
+	}
+	return "Bearer " + c.token
+}
+
+// do executes a request with the given method against the given path, which
+// is relative to the endpoint and whose segments are escaped as necessary.
+// The given body, if non-nil, is sent as JSON. If the response has one of the
+// given statuses, its body, if any, is decoded into out, if non-nil, and its
+// header is returned. Otherwise, an *APIError is returned.
+func (c *Client) do(
+	ctx context.Context,
+	method string,
+	path []string,
+	query url.Values,
+	body any,
+	out any,
+	statuses ...int,
+) (http.Header, error) {
+	var reqBody io.Reader
+	if body != nil {
+		bodyBytes, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling request body to JSON: %w", err)
+		}
+		// A *bytes.Reader makes http.NewRequest set GetBody
+		reqBody = bytes.NewReader(bodyBytes)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.url(path, query), reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("error building LiveDNS API request: %w", err)
+	}
+	req.Header.Set("Authorization", c.authorization())
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error executing LiveDNS API request: %w", err)
+	}
+	defer res.Body.Close()
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading LiveDNS API response body: %w", err)
+	}
+	if !slices.Contains(statuses, res.StatusCode) {
+		return nil, newAPIError(res.StatusCode, resBody)
+	}
+	if out != nil && len(resBody) > 0 {
+		if err = json.Unmarshal(resBody, out); err != nil {
+			return nil, fmt.Errorf("error unmarshaling LiveDNS API response from JSON: %w", err)
+		}
+	}
+	return res.Header, nil
+}
+
+// url returns the URL of the given path, relative to the endpoint, with the
+// given query.
+func (c *Client) url(path []string, query url.Values) string {
+	var sb strings.Builder
+	sb.WriteString(c.endpoint)
+	for _, segment := range path {
+		sb.WriteByte('/')
+		sb.WriteString(url.PathEscape(segment))
+	}
+	if len(query) > 0 {
+		sb.WriteByte('?')
+		sb.WriteString(query.Encode())
+	}
+	return sb.String()
+}
+
+// list retrieves every page of the listing at the given path with the given
+// query. Listing stops once Gandi's reported total has been retrieved or,
+// failing that, a page that isn't full is received. It also stops once a page
+// yields nothing new, which is what a server that ignores pagination returns
+// when asked for the page after the first.
+func list[T any](ctx context.Context, c *Client, path []string, query url.Values) ([]T, error) {
+	all := []T{}
+	var previous json.RawMessage
+	for page := 1; ; page++ {
+		pageQuery := url.Values{}
+		maps.Copy(pageQuery, query)
+		pageQuery.Set("page", strconv.Itoa(page))
+		pageQuery.Set("per_page", strconv.Itoa(c.pageSize))
+		var raw json.RawMessage
+		header, err := c.do(ctx, http.MethodGet, path, pageQuery, nil, &raw, http.StatusOK)
+		if err != nil {
+			return nil, err
+		}
+		if page > 1 && bytes.Equal(raw, previous) {
+			return all, nil
+		}
+		previous = raw
+		items := []T{}
+		if len(raw) > 0 {
+			if err = json.Unmarshal(raw, &items); err != nil {
+				return nil, fmt.Errorf("error unmarshaling LiveDNS API response from JSON: %w", err)
+			}
+		}
+		all = append(all, items...)
+		if total, err := strconv.Atoi(header.Get(totalCountHeader)); err == nil {
+			if len(all) >= total || len(items) == 0 {
+				return all, nil
+			}
+			continue
+		}
+		// Without a total, a page that isn't exactly full is the last one
+		if len(items) != c.pageSize {
+			return all, nil
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package livedns
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testDomain = "example.com"
+	testName   = "_acme-challenge"
+	testToken  = "fakeToken"
+)
+
+// newTestClient returns a Client for a test server that serves requests using
+// the given handler.
+func newTestClient(t *testing.T, handler http.HandlerFunc, opts ...Option) *Client {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return NewClient(testToken, append([]Option{WithEndpoint(srv.URL + "/")}, opts...)...)
+}
+
+func TestNewClient(t *testing.T) {
+	c := NewClient(testToken)
+	require.Equal(t, DefaultEndpoint, c.endpoint)
+	require.Equal(t, defaultPageSize, c.pageSize)
+	require.NotNil(t, c.httpClient)
+
+	httpClient := &http.Client{}
+	c = NewClient(
+		testToken,
+		WithEndpoint("https://livedns.example.com/v5/livedns/"),
+		WithHTTPClient(httpClient),
+		WithPageSize(10),
+	)
+	require.Equal(t, "https://livedns.example.com/v5/livedns", c.endpoint)
+	require.Same(t, httpClient, c.httpClient)
+	require.Equal(t, 10, c.pageSize)
+
+	// Meaningless options should be ignored
+	c = NewClient(testToken, WithEndpoint(""), WithPageSize(0))
+	require.Equal(t, DefaultEndpoint, c.endpoint)
+	require.Equal(t, defaultPageSize, c.pageSize)
+}
+
+func TestClientHeaders(t *testing.T) {
+	testCases := []struct {
+		name       string
+		opts       []Option
+		assertions func(*testing.T, *http.Request)
+	}{
+		{
+			name: "personal access token",
+			assertions: func(t *testing.T, r *http.Request) {
+				require.Equal(t, "Bearer "+testToken, r.Header.Get("Authorization"))
+				require.Equal(t, "application/json", r.Header.Get("Accept"))
+			},
+		},
+		{
+			name: "legacy API key",
+			opts: []Option{WithAPIKey()},
+			assertions: func(t *testing.T, r *http.Request) {
+				require.Equal(t, "Apikey "+testToken, r.Header.Get("Authorization"))
+			},
+		},
+		{
+			name: "user agent",
+			opts: []Option{WithUserAgent("test-agent/1.0")},
+			assertions: func(t *testing.T, r *http.Request) {
+				require.Equal(t, "test-agent/1.0", r.Header.Get("User-Agent"))
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			c := newTestClient(
+				t,
+				func(w http.ResponseWriter, r *http.Request) {
+					testCase.assertions(t, r)
+					w.WriteHeader(http.StatusNoContent)
+				},
+				testCase.opts...,
+			)
+			require.NoError(t, c.DeleteRecord(context.Background(), testDomain, testName, TypeTXT))
+		})
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	testCases := []struct {
+		name       string
+		handler    http.HandlerFunc
+		ctx        func() (context.Context, context.CancelFunc)
+		assertions func(*testing.T, error)
+	}{
+		{
+			name: "Gandi error",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{
+					"code": 403,
+					"message": "Access was denied to this resource.",
+					"object": "HTTPForbidden",
+					"cause": "Forbidden"
+				}`))
+			},
+			assertions: func(t *testing.T, err error) {
+				require.True(t, IsForbidden(err))
+				apiErr := &APIError{}
+				require.ErrorAs(t, err, &apiErr)
+				require.Equal(t, "Access was denied to this resource.", apiErr.Message)
+			},
+		},
+		{
+			name: "unexpected status code",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+			},
+			assertions: func(t *testing.T, err error) {
+				require.ErrorContains(t, err, "unexpected HTTP status")
+				require.ErrorContains(t, err, strconv.Itoa(http.StatusBadRequest))
+			},
+		},
+		{
+			name: "malformed response",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write([]byte(`{`))
+			},
+			assertions: func(t *testing.T, err error) {
+				require.ErrorContains(t, err, "error unmarshaling LiveDNS API response from JSON")
+			},
+		},
+		{
+			name: "context canceled",
+			handler: func(_ http.ResponseWriter, r *http.Request) {
+				// Block until the client gives up
+				<-r.Context().Done()
+			},
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 100*time.Millisecond)
+			},
+			assertions: func(t *testing.T, err error) {
+				require.ErrorIs(t, err, context.DeadlineExceeded)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			if testCase.ctx != nil {
+				ctx, cancel = testCase.ctx()
+			}
+			defer cancel()
+			c := newTestClient(t, testCase.handler)
+			_, err := c.GetRecord(ctx, testDomain, testName, TypeTXT)
+			testCase.assertions(t, err)
+		})
+	}
+}
+
+func TestClientPagination(t *testing.T) {
+	domains := make([]string, 7)
+	for i := range domains {
+		domains[i] = fmt.Sprintf(`{"fqdn": "example%d.com"}`, i)
+	}
+	testCases := []struct {
+		name       string
+		totalCount bool
+		// ignorePagination makes the server return all items at once
+		ignorePagination bool
+		// pageSize defaults to 3
+		pageSize int
+		pages    int
+	}{
+		{
+			name:       "total count reported",
+			totalCount: true,
+			pages:      3,
+		},
+		{
+			name:  "total count not reported",
+			pages: 3,
+		},
+		{
+			name:             "pagination ignored",
+			ignorePagination: true,
+			pages:            1,
+		},
+		{
+			name:             "pagination ignored with a full page",
+			ignorePagination: true,
+			pageSize:         len(domains),
+			pages:            2,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var pages int
+			c := newTestClient(
+				t,
+				func(w http.ResponseWriter, r *http.Request) {
+					pages++
+					page, err := strconv.Atoi(r.URL.Query().Get("page"))
+					require.NoError(t, err)
+					perPage, err := strconv.Atoi(r.URL.Query().Get("per_page"))
+					require.NoError(t, err)
+					start, end := (page-1)*perPage, page*perPage
+					if testCase.ignorePagination {
+						start, end = 0, len(domains)
+					}
+					start, end = min(start, len(domains)), min(end, len(domains))
+					if testCase.totalCount {
+						w.Header().Set(totalCountHeader, strconv.Itoa(len(domains)))
+					}
+					_, _ = fmt.Fprintf(w, "[%s]", strings.Join(domains[start:end], ","))
+				},
+				WithPageSize(cmp.Or(testCase.pageSize, 3)),
+			)
+			list, err := c.ListDomains(context.Background())
+			require.NoError(t, err)
+			require.Len(t, list, len(domains))
+			for i, domain := range list {
+				require.Equal(t, fmt.Sprintf("example%d.com", i), domain.FQDN)
+			}
+			require.Equal(t, testCase.pages, pages)
+		})
+	}
+}
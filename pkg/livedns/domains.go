@@ -0,0 +1,48 @@
+package livedns
+
+import (
+	"context"
+	"net/http"
+)
+
+// Domain is a domain hosted by Gandi LiveDNS.
+type Domain struct {
+	// FQDN is the fully qualified name of the domain, without a trailing dot.
+	FQDN string `json:"fqdn"`
+	// Href is the URL of the domain in the LiveDNS API.
+	Href string `json:"domain_href,omitempty"`
+	// RecordsHref is the URL of the domain's record sets in the LiveDNS API.
+	RecordsHref string `json:"domain_records_href,omitempty"`
+	// KeysHref is the URL of the domain's DNSSEC keys in the LiveDNS API.
+	KeysHref string `json:"domain_keys_href,omitempty"`
+	// AutomaticSnapshots indicates whether Gandi snapshots the domain's zone
+	// before every change. It is only reported by GetDomain.
+	AutomaticSnapshots *bool `json:"automatic_snapshots,omitempty"`
+}
+
+// ListDomains returns all domains visible to the client's credential.
+func (c *Client) ListDomains(ctx context.Context) ([]Domain, error) {
+	// GET <ENDPOINT>/domains
+	return list[Domain](ctx, c, []string{"domains"}, nil)
+}
+
+// GetDomain returns the domain with the given name. If the domain is not
+// hosted by Gandi LiveDNS or is not visible to the client's credential, the
+// returned error satisfies IsNotFound or, for a domain belonging to someone
+// else, IsForbidden.
+func (c *Client) GetDomain(ctx context.Context, fqdn string) (*Domain, error) {
+	// GET <ENDPOINT>/domains/<FQDN>
+	domain := &Domain{}
+	if _, err := c.do(
+		ctx,
+		http.MethodGet,
+		[]string{"domains", fqdn},
+		nil,
+		nil,
+		domain,
+		http.StatusOK,
+	); err != nil {
+		return nil, err
+	}
+	return domain, nil
+}
@@ -0,0 +1,74 @@
+package livedns
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetDomain(t *testing.T) {
+	testCases := []struct {
+		name       string
+		status     int
+		response   string
+		assertions func(*testing.T, *Domain, error)
+	}{
+		{
+			name:   "domain exists",
+			status: http.StatusOK,
+			response: `{
+				"fqdn": "example.com",
+				"domain_href": "https://api.gandi.net/v5/livedns/domains/example.com",
+				"automatic_snapshots": true
+			}`,
+			assertions: func(t *testing.T, domain *Domain, err error) {
+				require.NoError(t, err)
+				require.Equal(t, testDomain, domain.FQDN)
+				require.NotEmpty(t, domain.Href)
+				require.NotNil(t, domain.AutomaticSnapshots)
+				require.True(t, *domain.AutomaticSnapshots)
+			},
+		},
+		{
+			name:   "domain not found",
+			status: http.StatusNotFound,
+			assertions: func(t *testing.T, domain *Domain, err error) {
+				require.True(t, IsNotFound(err))
+				require.Nil(t, domain)
+			},
+		},
+		{
+			name:   "domain belongs to someone else",
+			status: http.StatusForbidden,
+			assertions: func(t *testing.T, domain *Domain, err error) {
+				require.True(t, IsForbidden(err))
+				require.Nil(t, domain)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, http.MethodGet, r.Method)
+				require.Equal(t, "/domains/example.com", r.URL.Path)
+				w.WriteHeader(testCase.status)
+				_, _ = w.Write([]byte(testCase.response))
+			})
+			domain, err := c.GetDomain(context.Background(), testDomain)
+			testCase.assertions(t, domain, err)
+		})
+	}
+}
+
+func TestListDomains(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodGet, r.Method)
+		require.Equal(t, "/domains", r.URL.Path)
+		_, _ = w.Write([]byte(`[{"fqdn": "example.com"}, {"fqdn": "example.org"}]`))
+	})
+	domains, err := c.ListDomains(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []Domain{{FQDN: "example.com"}, {FQDN: "example.org"}}, domains)
+}
@@ -0,0 +1,110 @@
+package livedns
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// APIError represents an error response from the Gandi LiveDNS API. It is
+// decoded from the body of any response with an unexpected HTTP status.
+type APIError struct {
+	// StatusCode is the HTTP status of the response.
+	StatusCode int `json:"-"`
+	// Code is the error code reported by Gandi. In practice, it mirrors the
+	// HTTP status.
+	Code int `json:"code"`
+	// Message is a human-readable description of the error.
+	Message string `json:"message"`
+	// Object is the type of error reported by Gandi, e.g. "HTTPForbidden".
+	Object string `json:"object"`
+	// Cause is a short summary of the cause of the error, e.g. "Forbidden".
+	Cause string `json:"cause"`
+	// Errors contains details about individual fields of the request that were
+	// found to be invalid, if any.
+	Errors []APIFieldError `json:"errors"`
+}
+
+// APIFieldError describes a problem with a single field of a request made to
+// the Gandi LiveDNS API.
+type APIFieldError struct {
+	// Location is the part of the request where the field was found, e.g.
+	// "body" or "query".
+	Location string `json:"location"`
+	// Name is the name of the invalid field.
+	Name string `json:"name"`
+	// Description describes what is wrong with the field.
+	Description string `json:"description"`
+}
+
+// newAPIError returns an *APIError built from the given HTTP status and
+// response body. Bodies that cannot be decoded are tolerated, in which case
+// the returned error carries only the HTTP status.
+func newAPIError(status int, body []byte) *APIError {
+	apiErr := &APIError{}
+	if len(body) > 0 {
+		// A failure to decode the body isn't an error in its own right. Whatever
+		// could be decoded is kept and the status is still reported.
+		_ = json.Unmarshal(body, apiErr)
+	}
+	apiErr.StatusCode = status
+	return apiErr
+}
+
+// Error implements the error interface.
+func (e *APIError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(
+		&sb,
+		"unexpected HTTP status in response to Live DNS API request: %d",
+		e.StatusCode,
+	)
+	if e.Cause != "" {
+		fmt.Fprintf(&sb, " (%s)", e.Cause)
+	}
+	if e.Message != "" {
+		fmt.Fprintf(&sb, ": %s", e.Message)
+	}
+	for _, fieldErr := range e.Errors {
+		fmt.Fprintf(&sb, "; %s %s: %s", fieldErr.Location, fieldErr.Name, fieldErr.Description)
+	}
+	return sb.String()
+}
+
+// IsUnauthorized returns true if the given error is or wraps an *APIError
+// indicating the credential used was missing, invalid, or expired.
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized)
+}
+
+// IsForbidden returns true if the given error is or wraps an *APIError
+// indicating the credential used lacks permission to perform the requested
+// operation.
+func IsForbidden(err error) bool {
+	return hasStatus(err, http.StatusForbidden)
+}
+
+// IsNotFound returns true if the given error is or wraps an *APIError
+// indicating the requested resource does not exist.
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsRateLimited returns true if the given error is or wraps an *APIError
+// indicating the request was refused because of rate limiting.
+func IsRateLimited(err error) bool {
+	return hasStatus(err, http.StatusTooManyRequests)
+}
+
+// IsConflict returns true if the given error is or wraps an *APIError
+// indicating the request conflicts with the current state of a resource.
+func IsConflict(err error) bool {
+	return hasStatus(err, http.StatusConflict)
+}
+
+func hasStatus(err error, status int) bool {
+	apiErr := &APIError{}
+	return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
@@ -0,0 +1,114 @@
+package livedns
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAPIError(t *testing.T) {
+	testCases := []struct {
+		name       string
+		status     int
+		body       string
+		assertions func(*testing.T, *APIError)
+	}{
+		{
+			name:   "empty body",
+			status: http.StatusBadGateway,
+			assertions: func(t *testing.T, err *APIError) {
+				require.Equal(t, http.StatusBadGateway, err.StatusCode)
+				require.Equal(
+					t,
+					"unexpected HTTP status in response to Live DNS API request: 502",
+					err.Error(),
+				)
+			},
+		},
+		{
+			name:   "body is not JSON",
+			status: http.StatusBadGateway,
+			body:   "<html>Bad Gateway</html>",
+			assertions: func(t *testing.T, err *APIError) {
+				require.Equal(t, http.StatusBadGateway, err.StatusCode)
+				require.Empty(t, err.Message)
+			},
+		},
+		{
+			name:   "Gandi error",
+			status: http.StatusForbidden,
+			body: `{
+				"code": 403,
+				"message": "Access was denied to this resource.",
+				"object": "HTTPForbidden",
+				"cause": "Forbidden"
+			}`,
+			assertions: func(t *testing.T, err *APIError) {
+				require.Equal(t, http.StatusForbidden, err.StatusCode)
+				require.Equal(t, http.StatusForbidden, err.Code)
+				require.Equal(t, "HTTPForbidden", err.Object)
+				require.Equal(
+					t,
+					"unexpected HTTP status in response to Live DNS API request: 403 "+
+						"(Forbidden): Access was denied to this resource.",
+					err.Error(),
+				)
+			},
+		},
+		{
+			name:   "Gandi error with field errors",
+			status: http.StatusBadRequest,
+			body: `{
+				"code": 400,
+				"message": "Validation error",
+				"object": "HTTPBadRequest",
+				"cause": "Bad Request",
+				"errors": [{
+					"location": "body",
+					"name": "rrset_ttl",
+					"description": "must be at least 300"
+				}]
+			}`,
+			assertions: func(t *testing.T, err *APIError) {
+				require.Len(t, err.Errors, 1)
+				require.Equal(t, "rrset_ttl", err.Errors[0].Name)
+				require.Contains(t, err.Error(), "Validation error")
+				require.Contains(t, err.Error(), "body rrset_ttl: must be at least 300")
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			testCase.assertions(
+				t,
+				newAPIError(testCase.status, []byte(testCase.body)),
+			)
+		})
+	}
+}
+
+func TestAPIErrorHelpers(t *testing.T) {
+	helpers := map[int]func(error) bool{
+		http.StatusUnauthorized:    IsUnauthorized,
+		http.StatusForbidden:       IsForbidden,
+		http.StatusNotFound:        IsNotFound,
+		http.StatusTooManyRequests: IsRateLimited,
+		http.StatusConflict:        IsConflict,
+	}
+	for status, helper := range helpers {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			err := fmt.Errorf("wrapped: %w", newAPIError(status, nil))
+			require.True(t, helper(err))
+			for otherStatus, otherHelper := range helpers {
+				if otherStatus != status {
+					require.False(t, otherHelper(err))
+				}
+			}
+			require.False(t, helper(errors.New("something else")))
+			require.False(t, helper(nil))
+		})
+	}
+}
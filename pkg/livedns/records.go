@@ -0,0 +1,200 @@
+package livedns
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Types of resource record sets supported by Gandi LiveDNS.
+const (
+	TypeA          = "A"
+	TypeAAAA       = "AAAA"
+	TypeALIAS      = "ALIAS"
+	TypeCAA        = "CAA"
+	TypeCDS        = "CDS"
+	TypeCNAME      = "CNAME"
+	TypeDNAME      = "DNAME"
+	TypeDS         = "DS"
+	TypeKEY        = "KEY"
+	TypeLOC        = "LOC"
+	TypeMX         = "MX"
+	TypeNAPTR      = "NAPTR"
+	TypeNS         = "NS"
+	TypeOPENPGPKEY = "OPENPGPKEY"
+	TypePTR        = "PTR"
+	TypeRP         = "RP"
+	TypeSPF        = "SPF"
+	TypeSRV        = "SRV"
+	TypeSSHFP      = "SSHFP"
+	TypeTLSA       = "TLSA"
+	TypeTXT        = "TXT"
+	TypeWKS        = "WKS"
+)
+
+// RRSet is a resource record set: all records of a single type with a single
+// name within a domain.
+type RRSet struct {
+	// Type is the type of the records, e.g. TypeTXT.
+	Type string `json:"rrset_type"`
+	// TTL is the TTL of the records in seconds. If zero when creating a record
+	// set, Gandi applies its default.
+	TTL int `json:"rrset_ttl,omitempty"`
+	// Name is the name of the records relative to the domain, e.g. "www", or
+	// "@" for the apex.
+	Name string `json:"rrset_name"`
+	// Values are the values of the records in presentation format. Gandi
+	// quotes the values of TXT records. See QuoteTXT and UnquoteTXT.
+	Values []string `json:"rrset_values"`
+	// Href is the URL of the record set in the LiveDNS API. It is ignored when
+	// creating or updating a record set.
+	Href string `json:"rrset_href,omitempty"`
+}
+
+// ListOption is a function that narrows the record sets returned by
+// ListRecords.
+type ListOption func(url.Values)
+
+// WithType returns a ListOption that selects only record sets of the given
+// type.
+func WithType(rrsetType string) ListOption {
+	return func(query url.Values) {
+		query.Set("rrset_type", rrsetType)
+	}
+}
+
+// ListRecords returns the record sets in the domain with the given name,
+// narrowed by the given options.
+func (c *Client) ListRecords(ctx context.Context, fqdn string, opts ...ListOption) ([]RRSet, error) {
+	// GET <ENDPOINT>/domains/<FQDN>/records
+	query := url.Values{}
+	for _, opt := range opts {
+		opt(query)
+	}
+	return list[RRSet](ctx, c, []string{"domains", fqdn, "records"}, query)
+}
+
+// ListRecordsByName returns the record sets of all types with the given name
+// in the domain with the given name.
+func (c *Client) ListRecordsByName(ctx context.Context, fqdn string, name string) ([]RRSet, error) {
+	// GET <ENDPOINT>/domains/<FQDN>/records/<NAME>
+	return list[RRSet](ctx, c, []string{"domains", fqdn, "records", name}, nil)
+}
+
+// GetRecord returns the record set with the given name and type in the domain
+// with the given name. If no such record set exists, the returned error
+// satisfies IsNotFound.
+func (c *Client) GetRecord(
+	ctx context.Context,
+	fqdn string,
+	name string,
+	rrsetType string,
+) (*RRSet, error) {
+	// GET <ENDPOINT>/domains/<FQDN>/records/<NAME>/<TYPE>
+	rrs := &RRSet{}
+	if _, err := c.do(
+		ctx,
+		http.MethodGet,
+		[]string{"domains", fqdn, "records", name, rrsetType},
+		nil,
+		nil,
+		rrs,
+		http.StatusOK,
+	); err != nil {
+		return nil, err
+	}
+	return rrs, nil
+}
+
+// CreateRecord creates the given record set in the domain with the given
+// name. If a record set with the same name and type already exists, the
+// returned error satisfies IsConflict.
+func (c *Client) CreateRecord(ctx context.Context, fqdn string, rrs RRSet) error {
+	// POST <ENDPOINT>/domains/<FQDN>/records
+	rrs.Href = ""
+	_, err := c.do(
+		ctx,
+		http.MethodPost,
+		[]string{"domains", fqdn, "records"},
+		nil,
+		rrs,
+		nil,
+		http.StatusOK, http.StatusCreated,
+	)
+	return err
+}
+
+// UpdateRecord replaces the TTL and values of the record set with the name and
+// type of the given one in the domain with the given name, creating the record
+// set if it doesn't exist.
+func (c *Client) UpdateRecord(ctx context.Context, fqdn string, rrs RRSet) error {
+	// PUT <ENDPOINT>/domains/<FQDN>/records/<NAME>/<TYPE>
+	_, err := c.do(
+		ctx,
+		http.MethodPut,
+		[]string{"domains", fqdn, "records", rrs.Name, rrs.Type},
+		nil,
+		struct {
+			TTL    int      `json:"rrset_ttl,omitempty"`
+			Values []string `json:"rrset_values"`
+		}{
+			TTL:    rrs.TTL,
+			Values: rrs.Values,
+		},
+		nil,
+		http.StatusOK, http.StatusCreated,
+	)
+	return err
+}
+
+// DeleteRecord deletes the record set with the given name and type from the
+// domain with the given name. If no such record set exists, the returned
+// error satisfies IsNotFound.
+func (c *Client) DeleteRecord(
+	ctx context.Context,
+	fqdn string,
+	name string,
+	rrsetType string,
+) error {
+	// DELETE <ENDPOINT>/domains/<FQDN>/records/<NAME>/<TYPE>
+	_, err := c.do(
+		ctx,
+		http.MethodDelete,
+		[]string{"domains", fqdn, "records", name, rrsetType},
+		nil,
+		nil,
+		nil,
+		http.StatusOK, http.StatusNoContent,
+	)
+	return err
+}
+
+// DeleteRecordsByName deletes the record sets of all types with the given
+// name from the domain with the given name.
+func (c *Client) DeleteRecordsByName(ctx context.Context, fqdn string, name string) error {
+	// DELETE <ENDPOINT>/domains/<FQDN>/records/<NAME>
+	_, err := c.do(
+		ctx,
+		http.MethodDelete,
+		[]string{"domains", fqdn, "records", name},
+		nil,
+		nil,
+		nil,
+		http.StatusOK, http.StatusNoContent,
+	)
+	return err
+}
+
+// QuoteTXT returns the given TXT record value surrounded by quotes, which is
+// the form in which Gandi itself returns such values. A value that is already
+// quoted is left as it is.
+func QuoteTXT(value string) string {
+	return fmt.Sprintf(`"%s"`, UnquoteTXT(value))
+}
+
+// UnquoteTXT removes the quotes that Gandi places around TXT record values.
+func UnquoteTXT(value string) string {
+	return strings.Trim(value, `"`)
+}
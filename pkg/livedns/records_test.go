@@ -0,0 +1,216 @@
+package livedns
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecords(t *testing.T) {
+	testCases := []struct {
+		name string
+		// method and path are those of the expected request
+		method string
+		path   string
+		query  string
+		// body is the expected request body, if any
+		body string
+		// status and response are returned by the test server
+		status     int
+		response   string
+		do         func(context.Context, *Client) (any, error)
+		assertions func(*testing.T, any, error)
+	}{
+		{
+			name:     "list records",
+			method:   http.MethodGet,
+			path:     "/domains/example.com/records",
+			query:    "page=1&per_page=100",
+			status:   http.StatusOK,
+			response: `[{"rrset_type":"A","rrset_ttl":300,"rrset_name":"www","rrset_values":["192.0.2.1"]}]`,
+			do: func(ctx context.Context, c *Client) (any, error) {
+				return c.ListRecords(ctx, testDomain)
+			},
+			assertions: func(t *testing.T, result any, err error) {
+				require.NoError(t, err)
+				require.Equal(
+					t,
+					[]RRSet{{Type: TypeA, TTL: 300, Name: "www", Values: []string{"192.0.2.1"}}},
+					result,
+				)
+			},
+		},
+		{
+			name:     "list records of type",
+			method:   http.MethodGet,
+			path:     "/domains/example.com/records",
+			query:    "page=1&per_page=100&rrset_type=TXT",
+			status:   http.StatusOK,
+			response: `[]`,
+			do: func(ctx context.Context, c *Client) (any, error) {
+				return c.ListRecords(ctx, testDomain, WithType(TypeTXT))
+			},
+			assertions: func(t *testing.T, result any, err error) {
+				require.NoError(t, err)
+				require.Empty(t, result)
+			},
+		},
+		{
+			name:   "list records by name",
+			method: http.MethodGet,
+			path:   "/domains/example.com/records/www",
+			query:  "page=1&per_page=100",
+			status: http.StatusOK,
+			response: `[{"rrset_type":"A","rrset_name":"www","rrset_values":["192.0.2.1"]},` +
+				`{"rrset_type":"AAAA","rrset_name":"www","rrset_values":["2001:db8::1"]}]`,
+			do: func(ctx context.Context, c *Client) (any, error) {
+				return c.ListRecordsByName(ctx, testDomain, "www")
+			},
+			assertions: func(t *testing.T, result any, err error) {
+				require.NoError(t, err)
+				require.Len(t, result, 2)
+			},
+		},
+		{
+			name:   "get record",
+			method: http.MethodGet,
+			path:   "/domains/example.com/records/_acme-challenge/TXT",
+			status: http.StatusOK,
+			response: `{"rrset_type":"TXT","rrset_ttl":600,"rrset_name":"_acme-challenge",` +
+				`"rrset_values":["\"foo\""],"rrset_href":"https://api.gandi.net/v5/livedns/..."}`,
+			do: func(ctx context.Context, c *Client) (any, error) {
+				return c.GetRecord(ctx, testDomain, testName, TypeTXT)
+			},
+			assertions: func(t *testing.T, result any, err error) {
+				require.NoError(t, err)
+				rrs, ok := result.(*RRSet)
+				require.True(t, ok)
+				require.Equal(t, 600, rrs.TTL)
+				require.Equal(t, []string{`"foo"`}, rrs.Values)
+				require.NotEmpty(t, rrs.Href)
+			},
+		},
+		{
+			name:   "get missing record",
+			method: http.MethodGet,
+			path:   "/domains/example.com/records/_acme-challenge/TXT",
+			status: http.StatusNotFound,
+			do: func(ctx context.Context, c *Client) (any, error) {
+				return c.GetRecord(ctx, testDomain, testName, TypeTXT)
+			},
+			assertions: func(t *testing.T, _ any, err error) {
+				require.True(t, IsNotFound(err))
+			},
+		},
+		{
+			name:   "create record",
+			method: http.MethodPost,
+			path:   "/domains/example.com/records",
+			body:   `{"rrset_type":"MX","rrset_ttl":300,"rrset_name":"@","rrset_values":["10 mx.example.com."]}`,
+			status: http.StatusCreated,
+			do: func(ctx context.Context, c *Client) (any, error) {
+				return nil, c.CreateRecord(ctx, testDomain, RRSet{
+					Type:   TypeMX,
+					TTL:    300,
+					Name:   "@",
+					Values: []string{"10 mx.example.com."},
+					Href:   "ignored",
+				})
+			},
+			assertions: func(t *testing.T, _ any, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:   "create existing record",
+			method: http.MethodPost,
+			path:   "/domains/example.com/records",
+			body:   `{"rrset_type":"CNAME","rrset_name":"www","rrset_values":["example.com."]}`,
+			status: http.StatusConflict,
+			do: func(ctx context.Context, c *Client) (any, error) {
+				return nil, c.CreateRecord(ctx, testDomain, RRSet{
+					Type:   TypeCNAME,
+					Name:   "www",
+					Values: []string{"example.com."},
+				})
+			},
+			assertions: func(t *testing.T, _ any, err error) {
+				require.True(t, IsConflict(err))
+			},
+		},
+		{
+			name:   "update record",
+			method: http.MethodPut,
+			path:   "/domains/example.com/records/_acme-challenge/TXT",
+			body:   `{"rrset_ttl":600,"rrset_values":["\"foo\"","\"bar\""]}`,
+			status: http.StatusCreated,
+			do: func(ctx context.Context, c *Client) (any, error) {
+				return nil, c.UpdateRecord(ctx, testDomain, RRSet{
+					Type:   TypeTXT,
+					TTL:    600,
+					Name:   testName,
+					Values: []string{QuoteTXT("foo"), QuoteTXT(`"bar"`)},
+				})
+			},
+			assertions: func(t *testing.T, _ any, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:   "delete record",
+			method: http.MethodDelete,
+			path:   "/domains/example.com/records/_acme-challenge/TXT",
+			status: http.StatusNoContent,
+			do: func(ctx context.Context, c *Client) (any, error) {
+				return nil, c.DeleteRecord(ctx, testDomain, testName, TypeTXT)
+			},
+			assertions: func(t *testing.T, _ any, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:   "delete records by name",
+			method: http.MethodDelete,
+			path:   "/domains/example.com/records/www",
+			status: http.StatusNoContent,
+			do: func(ctx context.Context, c *Client) (any, error) {
+				return nil, c.DeleteRecordsByName(ctx, testDomain, "www")
+			},
+			assertions: func(t *testing.T, _ any, err error) {
+				require.NoError(t, err)
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				defer r.Body.Close()
+				require.Equal(t, testCase.method, r.Method)
+				require.Equal(t, testCase.path, r.URL.Path)
+				require.Equal(t, testCase.query, r.URL.RawQuery)
+				body, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				if testCase.body == "" {
+					require.Empty(t, body)
+				} else {
+					require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+					require.JSONEq(t, testCase.body, string(body))
+				}
+				w.WriteHeader(testCase.status)
+				_, _ = w.Write([]byte(testCase.response))
+			})
+			result, err := testCase.do(context.Background(), c)
+			testCase.assertions(t, result, err)
+		})
+	}
+}
+
+func TestQuoteTXT(t *testing.T) {
+	require.Equal(t, `"foo"`, QuoteTXT("foo"))
+	require.Equal(t, `"foo"`, QuoteTXT(`"foo"`))
+	require.Equal(t, "foo", UnquoteTXT(`"foo"`))
+	require.Equal(t, "foo", UnquoteTXT("foo"))
+}